@@ -2,21 +2,72 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"time"
 
+	"github.com/tom5760/swaybar-status/pango"
 	"github.com/tom5760/swaybar-status/upower"
 )
 
-func statusBattery(ctx context.Context, sb *StatusBar) error {
+// batteryData is the data battery templates are executed with.
+type batteryData struct {
+	Percentage float64
+
+	// State is one of "unknown", "charging", "discharging", "empty",
+	// "full", "pending charge" or "pending discharge".
+	State string
+
+	Icon string
+
+	// TimeToEmpty and TimeToFull are zero if unknown.
+	TimeToEmpty time.Duration
+	TimeToFull  time.Duration
+}
+
+type batteryOptions struct {
+	// Interval is how often to refresh the battery state.
+	Interval Duration `json:"interval"`
+
+	// WarningBelow shows the block as a warning when the charge percentage
+	// drops below this value while discharging.
+	WarningBelow float64 `json:"warning_below"`
+
+	// UrgentBelow marks the block urgent and critical when the charge
+	// percentage drops below this value.
+	UrgentBelow float64 `json:"urgent_below"`
+}
+
+func newBatteryModule(mc *ModuleConfig) (statusFunc, error) {
+	opts := batteryOptions{
+		Interval:     Duration(10 * time.Second),
+		WarningBelow: 30,
+		UrgentBelow:  15,
+	}
+
+	if err := mc.decodeOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	if opts.Interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+
+	m := mc.module()
+
+	return func(ctx context.Context, sb *StatusBar) error {
+		return statusBattery(ctx, sb, m, opts)
+	}, nil
+}
+
+func statusBattery(ctx context.Context, sb *StatusBar, m module, opts batteryOptions) error {
 	up, err := upower.New()
 	if err != nil {
 		return fmt.Errorf("failed to create upower: %w", err)
 	}
 
 	block := Block{
-		Name: "20-battery",
+		Name: m.name,
 	}
 
 	reloadDev := func() (*upower.Device, error) {
@@ -33,6 +84,9 @@ func statusBattery(ctx context.Context, sb *StatusBar) error {
 	}
 
 	timer := time.NewTimer(0)
+	refresh := sb.Refreshes(m.name)
+
+	sb.BindActions(block.Key(), nil, nil)
 
 	devAddedChan, devAddedUnsub, err := up.SubscribeDeviceAdded()
 	if err != nil {
@@ -49,18 +103,25 @@ func statusBattery(ctx context.Context, sb *StatusBar) error {
 	for ctx.Err() == nil {
 		select {
 		case <-devAddedChan:
-			log.Println("device added")
+			m.log.Debug("device added")
 			if dev, err = reloadDev(); err != nil {
 				return err
 			}
 
 		case <-devRemovedChan:
-			log.Println("device removed")
+			m.log.Debug("device removed")
 			if dev, err = reloadDev(); err != nil {
 				return err
 			}
 
+		case <-refresh:
+			resetTimer(timer, 0)
+
 		case <-timer.C:
+			if err := sb.WaitVisible(ctx); err != nil {
+				return nil
+			}
+
 			if err := dev.Refresh(); err != nil {
 				return fmt.Errorf("failed to refresh device: %w", err)
 			}
@@ -93,12 +154,42 @@ func statusBattery(ctx context.Context, sb *StatusBar) error {
 				label = "pending discharge"
 			}
 
-			block.FullText = fmt.Sprintf("🔋%v%% (%s)", percent, label)
-			block.Urgent = percent < 15
+			toEmpty, err := dev.TimeToEmpty()
+			if err != nil {
+				return fmt.Errorf("failed to get time to empty: %w", err)
+			}
+
+			toFull, err := dev.TimeToFull()
+			if err != nil {
+				return fmt.Errorf("failed to get time to full: %w", err)
+			}
+
+			icon := m.icons.level(percent, batteryIconLevels)
+			if state == upower.DeviceStateCharging {
+				icon = m.icons.get(iconBatteryCharging)
+			}
+
+			data := batteryData{
+				Percentage:  percent,
+				State:       label,
+				Icon:        icon,
+				TimeToEmpty: time.Duration(toEmpty) * time.Second,
+				TimeToFull:  time.Duration(toFull) * time.Second,
+			}
+
+			value := pango.Text(fmt.Sprintf("%s%v%%", icon, percent))
+
+			m.format(&block, data, pango.Join(
+				value,
+				pango.Small(pango.Text(fmt.Sprintf(" (%s)", label))),
+			), value)
+			block.Urgent = percent < opts.UrgentBelow
+			block.State = batteryState(state, percent, opts)
+			block.Percentage = int(percent)
 
 			sb.Update(block)
 
-			timer.Reset(10 * time.Second)
+			timer.Reset(time.Duration(opts.Interval))
 
 		case <-ctx.Done():
 			return nil
@@ -107,3 +198,16 @@ func statusBattery(ctx context.Context, sb *StatusBar) error {
 
 	return nil
 }
+
+func batteryState(state upower.DeviceState, percent float64, opts batteryOptions) State {
+	switch {
+	case percent < opts.UrgentBelow:
+		return StateCritical
+	case state == upower.DeviceStateCharging, state == upower.DeviceStateFullyCharged:
+		return StateGood
+	case percent < opts.WarningBelow:
+		return StateWarning
+	default:
+		return StateIdle
+	}
+}
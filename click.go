@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tom5760/swaybar-status/logging"
+)
+
+// clickTimeout is how long a click handler may run before it is reported as
+// hung.  Further clicks on the same block are dropped until it finishes.
+const clickTimeout = 5 * time.Second
+
+// ClickFunc handles a click event on a block.  The context is canceled when
+// the handler has run for too long.
+type ClickFunc func(ctx context.Context, evt ClickEvent)
+
+// OnClick sets the handler for click events on the block with the given key.
+func (s *StatusBar) OnClick(key BlockKey, fn ClickFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.clickMap[key] = fn
+}
+
+// Click dispatches a click event to the handler for its block.  Handlers run
+// in their own goroutine, so a slow handler doesn't hold up other events.
+// Handlers for the same block run one at a time, in order.
+func (s *StatusBar) Click(ctx context.Context, evt ClickEvent) {
+	key := BlockKey{
+		Name:     evt.Name,
+		Instance: evt.Instance,
+	}
+
+	s.lock.Lock()
+	fn, ok := s.clickMap[key]
+	sem, semOK := s.clickLocks[key]
+	if !semOK {
+		sem = make(chan struct{}, 1)
+		s.clickLocks[key] = sem
+	}
+	s.lock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	go runClick(ctx, sem, s.clickTimeout, key, fn, evt)
+}
+
+func runClick(ctx context.Context, sem chan struct{}, timeout time.Duration, key BlockKey, fn ClickFunc, evt ClickEvent) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			return
+		}
+		logging.New(key.Name).Warn("dropped click, previous handler still running", "instance", key.Instance)
+		return
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer func() { <-sem }()
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				logging.New(key.Name).Error("click handler panicked", "instance", key.Instance, "panic", r)
+			}
+		}()
+
+		fn(ctx, evt)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			return
+		}
+		logging.New(key.Name).Warn("click handler still running", "instance", key.Instance, "after", timeout)
+	}
+}
+
+// ClickMux routes click events to handlers by button and modifiers.
+type ClickMux struct {
+	routes []clickRoute
+}
+
+type clickRoute struct {
+	button    int
+	modifiers []string
+	fn        ClickFunc
+}
+
+// anyButton matches clicks with any button and modifiers.
+const anyButton = 0
+
+// Handle registers a handler for clicks with the given button while exactly
+// the given modifiers are held.  Handlers for anyButton match every click, so
+// they should be registered last.
+func (m *ClickMux) Handle(button int, fn ClickFunc, modifiers ...string) {
+	m.routes = append(m.routes, clickRoute{
+		button:    button,
+		modifiers: modifiers,
+		fn:        fn,
+	})
+}
+
+// ServeClick calls the first handler that matches the event.  It is a
+// ClickFunc, to be passed to OnClick.
+func (m *ClickMux) ServeClick(ctx context.Context, evt ClickEvent) {
+	for _, route := range m.routes {
+		if route.button == anyButton || route.button == evt.Button && evt.HasModifiers(route.modifiers...) {
+			route.fn(ctx, evt)
+			return
+		}
+	}
+}
+
+// refreshAction is available on every module, asking it to update its blocks.
+const refreshAction = "refresh"
+
+// ClickBinding binds a click with a button and modifiers to either one of a
+// module's built-in actions, or a shell command.
+type ClickBinding struct {
+	// Button 0 matches clicks with any button and modifiers.
+	Button    int      `json:"button"`
+	Modifiers []string `json:"modifiers,omitempty"`
+
+	// Action is the name of a built-in action of the module, e.g. "mute".
+	Action string `json:"action,omitempty"`
+
+	// Command is run with sh -c.  The placeholders {name}, {instance},
+	// {button}, {modifiers}, {x}, {y}, {relative_x}, {relative_y}, {width}
+	// and {height} are replaced by shell quoted values from the click event.
+	Command string `json:"command,omitempty"`
+}
+
+func (b *ClickBinding) validate(actions []string) error {
+	if b.Button < 0 {
+		return fmt.Errorf("invalid button %d", b.Button)
+	}
+
+	if b.Button == anyButton && len(b.Modifiers) > 0 {
+		return errors.New("modifiers can't be used with button 0")
+	}
+
+	if (b.Action == "") == (b.Command == "") {
+		return errors.New("exactly one of action or command must be set")
+	}
+
+	if b.Action == "" || b.Action == refreshAction {
+		return nil
+	}
+
+	for _, action := range actions {
+		if b.Action == action {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown action %q", b.Action)
+}
+
+// SetBindings sets the configured click bindings for blocks with the given
+// name.  It must be called before the module binds its actions.
+func (s *StatusBar) SetBindings(name string, bindings []ClickBinding) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.bindings[name] = bindings
+}
+
+// BindActions sets the click handler for a block from a module's actions.
+// Configured bindings take precedence over the module's default bindings.
+func (s *StatusBar) BindActions(key BlockKey, actions map[string]ClickFunc, defaults []ClickBinding) {
+	s.lock.Lock()
+	bindings := append([]ClickBinding(nil), s.bindings[key.Name]...)
+	s.lock.Unlock()
+
+	var mux ClickMux
+
+	for _, b := range append(bindings, defaults...) {
+		var fn ClickFunc
+
+		switch {
+		case b.Command != "":
+			fn = commandClickFunc(b.Command)
+
+		case b.Action == refreshAction:
+			name := key.Name
+			fn = func(ctx context.Context, evt ClickEvent) {
+				s.Refresh(name)
+			}
+
+		default:
+			fn = actions[b.Action]
+		}
+
+		if fn == nil {
+			continue
+		}
+
+		mux.Handle(b.Button, fn, b.Modifiers...)
+	}
+
+	s.OnClick(key, mux.ServeClick)
+}
+
+// commandClickFunc returns a handler that runs a shell command.  The command
+// isn't bound to the handler's context, so that it may keep running, e.g. to
+// launch an application.
+func commandClickFunc(command string) ClickFunc {
+	return func(ctx context.Context, evt ClickEvent) {
+		// Stdout is left alone, as it would corrupt the status bar output.
+		cmd := exec.Command("sh", "-c", expandClickPlaceholders(command, evt))
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Start(); err != nil {
+			logging.New(evt.Name).Warn("failed to run click command", "command", command, "err", err)
+			return
+		}
+
+		go func() {
+			if err := cmd.Wait(); err != nil {
+				logging.New(evt.Name).Warn("click command failed", "command", command, "err", err)
+			}
+		}()
+	}
+}
+
+func expandClickPlaceholders(command string, evt ClickEvent) string {
+	itoa := func(v int) string {
+		return shellQuote(strconv.Itoa(v))
+	}
+
+	r := strings.NewReplacer(
+		"{name}", shellQuote(evt.Name),
+		"{instance}", shellQuote(evt.Instance),
+		"{button}", itoa(evt.Button),
+		"{modifiers}", shellQuote(strings.Join(evt.Modifiers, "+")),
+		"{x}", itoa(evt.X),
+		"{y}", itoa(evt.Y),
+		"{relative_x}", itoa(evt.RelativeX),
+		"{relative_y}", itoa(evt.RelativeY),
+		"{width}", itoa(evt.Width),
+		"{height}", itoa(evt.Height),
+	)
+
+	return r.Replace(command)
+}
+
+// shellQuote quotes a string to be used as a single word by sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
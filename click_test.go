@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls until cond is true, failing the test after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestClickConcurrent registers and dispatches clicks from many goroutines,
+// and is meant to be run with -race.
+func TestClickConcurrent(t *testing.T) {
+	sb := NewStatusBar(nil)
+	ctx := context.Background()
+
+	var calls int64
+	handler := func(ctx context.Context, evt ClickEvent) {
+		atomic.AddInt64(&calls, 1)
+	}
+
+	const (
+		workers = 8
+		rounds  = 50
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		i := i
+		key := BlockKey{Name: "block", Instance: fmt.Sprint(i % 3)}
+
+		wg.Add(3)
+
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				sb.OnClick(key, handler)
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				sb.BindActions(key, map[string]ClickFunc{"count": handler}, []ClickBinding{
+					{Button: anyButton, Action: "count"},
+				})
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				sb.Click(ctx, ClickEvent{Name: key.Name, Instance: key.Instance, Button: 1 + i%5})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Clicks that arrived before any handler was set are ignored, and clicks
+	// on a busy block may be dropped, so only check that some got through.
+	waitFor(t, "clicks", func() bool { return atomic.LoadInt64(&calls) > 0 })
+}
+
+func TestClickHandlerTimeout(t *testing.T) {
+	sb := NewStatusBar(nil)
+	sb.clickTimeout = 20 * time.Millisecond
+	key := BlockKey{Name: "block"}
+
+	errs := make(chan error, 1)
+	sb.OnClick(key, func(ctx context.Context, evt ClickEvent) {
+		<-ctx.Done()
+		errs <- ctx.Err()
+	})
+
+	sb.Click(context.Background(), ClickEvent{Name: key.Name, Button: 1})
+
+	select {
+	case err := <-errs:
+		if err != context.DeadlineExceeded {
+			t.Errorf("handler context error = %v; want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler context wasn't canceled")
+	}
+}
+
+func TestClickDroppedWhileBusy(t *testing.T) {
+	sb := NewStatusBar(nil)
+	sb.clickTimeout = 20 * time.Millisecond
+	key := BlockKey{Name: "block"}
+
+	var calls int64
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+
+	sb.OnClick(key, func(ctx context.Context, evt ClickEvent) {
+		atomic.AddInt64(&calls, 1)
+		started <- struct{}{}
+		<-release
+	})
+
+	evt := ClickEvent{Name: key.Name, Button: 1}
+
+	sb.Click(context.Background(), evt)
+	<-started
+
+	// The second click waits for the first handler, and is dropped once the
+	// timeout passes.
+	sb.Click(context.Background(), evt)
+	time.Sleep(10 * sb.clickTimeout)
+
+	close(release)
+	time.Sleep(10 * sb.clickTimeout)
+
+	if n := atomic.LoadInt64(&calls); n != 1 {
+		t.Errorf("handler called %d times; want 1", n)
+	}
+
+	// Once the handler is done, clicks are handled again.
+	sb.Click(context.Background(), evt)
+	waitFor(t, "click after release", func() bool { return atomic.LoadInt64(&calls) == 2 })
+}
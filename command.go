@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tom5760/swaybar-status/pango"
+)
+
+const (
+	commandTimeout   = 10 * time.Second
+	commandMaxOutput = 4096
+
+	// commandUrgentStatus is the exit status i3blocks scripts use to mark
+	// their block as urgent.
+	commandUrgentStatus = 33
+)
+
+var (
+	commandActions = []string{"run"}
+
+	// Like i3blocks, clicks run the command again, with the click event in
+	// its environment.
+	commandBindings = []ClickBinding{
+		{Button: anyButton, Action: "run"},
+	}
+)
+
+type commandOptions struct {
+	// Command is run with sh -c.  It prints the block like an i3blocks
+	// script: the full text, short text, color and background on separate
+	// lines, all but the first optional.  No output hides the block.
+	Command string `json:"command"`
+
+	// Instance is the instance of the block, passed to the command.
+	Instance string `json:"instance"`
+
+	// Interval is how often to run the command.  Zero (default) runs it
+	// once, and then only on clicks, refreshes and signals.
+	Interval Duration `json:"interval"`
+
+	// Timeout is how long the command may run before it is killed.
+	Timeout Duration `json:"timeout"`
+
+	// MaxOutput is the most output, in bytes, that the command may print.
+	MaxOutput int `json:"max_output"`
+}
+
+func newCommandModule(mc *ModuleConfig) (statusFunc, error) {
+	opts := commandOptions{
+		Timeout:   Duration(commandTimeout),
+		MaxOutput: commandMaxOutput,
+	}
+
+	if err := mc.decodeOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	if opts.Command == "" {
+		return nil, errors.New("command must be set")
+	}
+
+	if opts.Interval < 0 {
+		return nil, errors.New("interval must not be negative")
+	}
+
+	if opts.Timeout <= 0 {
+		return nil, errors.New("timeout must be positive")
+	}
+
+	if opts.MaxOutput <= 0 {
+		return nil, errors.New("max_output must be positive")
+	}
+
+	m := mc.module()
+
+	return func(ctx context.Context, sb *StatusBar) error {
+		return statusCommand(ctx, sb, m, opts)
+	}, nil
+}
+
+func statusCommand(ctx context.Context, sb *StatusBar, m module, opts commandOptions) error {
+	key := BlockKey{
+		Name:     m.name,
+		Instance: opts.Instance,
+	}
+
+	timer := time.NewTimer(0)
+	refresh := sb.Refreshes(m.name)
+
+	clicks := make(chan ClickEvent, 1)
+
+	sb.BindActions(key, map[string]ClickFunc{
+		"run": func(ctx context.Context, evt ClickEvent) {
+			select {
+			case clicks <- evt:
+			default:
+			}
+		},
+	}, commandBindings)
+
+	for ctx.Err() == nil {
+		var click *ClickEvent
+
+		select {
+		case <-timer.C:
+		case <-refresh:
+		case evt := <-clicks:
+			click = &evt
+		case <-ctx.Done():
+			return nil
+		}
+
+		if err := sb.WaitVisible(ctx); err != nil {
+			return nil
+		}
+
+		block, err := runBlockCommand(ctx, m, opts, click)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if block.FullText == "" {
+			sb.Remove(key)
+		} else {
+			sb.Update(block)
+		}
+
+		if opts.Interval > 0 {
+			resetTimer(timer, time.Duration(opts.Interval))
+		}
+	}
+
+	return nil
+}
+
+// runBlockCommand runs a module's command, and parses its output into a
+// block.
+func runBlockCommand(ctx context.Context, m module, opts commandOptions, click *ClickEvent) (Block, error) {
+	block := Block{
+		Name:     m.name,
+		Instance: opts.Instance,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(opts.Timeout))
+	defer cancel()
+
+	// Commands printing too much are killed right away.
+	out := &limitedBuffer{limit: opts.MaxOutput, exceed: cancel}
+
+	cmd := exec.Command("sh", "-c", opts.Command)
+	cmd.Env = append(os.Environ(), commandEnv(block, opts, click)...)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+
+	// The command runs in its own process group, so that everything it
+	// started can be killed.  Otherwise a background process holding stdout
+	// open would keep Wait from returning.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := cmd.Start(); err != nil {
+		return block, fmt.Errorf("failed to run command: %w", err)
+	}
+
+	waitDone := make(chan struct{})
+	defer close(waitDone)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-waitDone:
+		}
+	}()
+
+	err := cmd.Wait()
+
+	if out.exceeded {
+		return block, fmt.Errorf("command printed more than %d bytes", opts.MaxOutput)
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return block, fmt.Errorf("command timed out after %v", time.Duration(opts.Timeout))
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == commandUrgentStatus {
+		block.Urgent = true
+	} else if err != nil {
+		return block, fmt.Errorf("command failed: %w", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(out.buf), "\n"), "\n")
+	line := func(i int) string {
+		if i < len(lines) {
+			return strings.TrimSpace(lines[i])
+		}
+		return ""
+	}
+
+	// Scripts written for i3blocks print markup if their block uses it.
+	text := pango.Text
+	if m.pango {
+		text = func(s string) pango.Markup { return pango.Markup(s) }
+	}
+
+	m.setText(&block, text(line(0)), text(line(1)))
+	block.Color = line(2)
+	block.Background = line(3)
+
+	return block, nil
+}
+
+// commandEnv returns the i3blocks environment variables describing a block,
+// and the click that ran the command, if any.
+func commandEnv(block Block, opts commandOptions, click *ClickEvent) []string {
+	env := []string{
+		"BLOCK_NAME=" + block.Name,
+		"BLOCK_INSTANCE=" + block.Instance,
+		"BLOCK_INTERVAL=" + strconv.Itoa(int(time.Duration(opts.Interval).Seconds())),
+	}
+
+	if click == nil {
+		return env
+	}
+
+	itoa := strconv.Itoa
+
+	return append(env,
+		"BLOCK_BUTTON="+itoa(click.Button),
+		"BLOCK_MODIFIERS="+strings.Join(click.Modifiers, ","),
+		"BLOCK_X="+itoa(click.X),
+		"BLOCK_Y="+itoa(click.Y),
+		"BLOCK_RELATIVE_X="+itoa(click.RelativeX),
+		"BLOCK_RELATIVE_Y="+itoa(click.RelativeY),
+		"BLOCK_WIDTH="+itoa(click.Width),
+		"BLOCK_HEIGHT="+itoa(click.Height),
+	)
+}
+
+// limitedBuffer collects output up to a limit, failing writes beyond it and
+// calling exceed.
+type limitedBuffer struct {
+	buf      []byte
+	limit    int
+	exceed   func()
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if len(b.buf)+len(p) > b.limit {
+		b.exceeded = true
+		b.exceed()
+		return 0, errors.New("output limit exceeded")
+	}
+
+	b.buf = append(b.buf, p...)
+
+	return len(p), nil
+}
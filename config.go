@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/tom5760/swaybar-status/logging"
+)
+
+const (
+	configDirName  = "swaybar-status"
+	configFileName = "config.json"
+
+	markupNone  = "none"
+	markupPango = "pango"
+)
+
+// defaultConfig is used when no configuration file exists.  It matches the
+// layout the bar had before it was configurable.
+var defaultConfig = Config{
+	Modules: []ModuleConfig{
+		{Module: "network"},
+		{Module: "battery"},
+		{Module: "volume"},
+		{Module: "time"},
+	},
+}
+
+// Config is the top level configuration file.
+type Config struct {
+	// Theme is the name of a built-in theme, or the path to a theme file.
+	Theme string `json:"theme,omitempty"`
+
+	// Icons is the name of a built-in icon set: "emoji" (default),
+	// "nerdfont" or "ascii".
+	Icons string `json:"icons,omitempty"`
+
+	// IconOverrides replaces icons in the icon set by key, e.g.
+	// {"volume.muted": "M"}.
+	IconOverrides map[string]string `json:"icon_overrides,omitempty"`
+
+	// Log configures where diagnostics are written, and how verbosely.
+	Log LogConfig `json:"log,omitempty"`
+
+	// Modules lists the modules to run, in display order.
+	Modules []ModuleConfig `json:"modules"`
+}
+
+// ModuleConfig configures a single instance of a module.
+type ModuleConfig struct {
+	// Module is the kind of module to run, e.g. "battery" or "time".
+	Module string `json:"module"`
+
+	// Name is used as the name of the module's blocks, and must be unique.
+	// Defaults to the kind of module.
+	Name string `json:"name,omitempty"`
+
+	// Position orders the module's blocks on the bar, lowest first.  Defaults
+	// to the module's index in the configuration file.
+	Position *int `json:"position,omitempty"`
+
+	// Markup is either "pango" to style blocks with Pango markup, or "none"
+	// (default) for plain text.
+	Markup string `json:"markup,omitempty"`
+
+	// Template and ShortTemplate are text/template templates for the full
+	// and short text of the module's blocks, executed with the module's data,
+	// e.g. "{{.Percentage}}% {{.State}}".  With Pango markup, their output is
+	// markup, and values should be escaped with the escape function.
+	Template      string `json:"template,omitempty"`
+	ShortTemplate string `json:"short_template,omitempty"`
+
+	// Signal is N for a real-time signal, SIGRTMIN+N, that makes the module
+	// refresh its blocks immediately.  Zero (default) disables it.
+	Signal int `json:"signal,omitempty"`
+
+	// Clicks bind clicks on the module's blocks to actions, overriding the
+	// module's default bindings.
+	Clicks []ClickBinding `json:"clicks,omitempty"`
+
+	// Options are module specific, and are decoded by the module itself.
+	Options json.RawMessage `json:"options,omitempty"`
+
+	// icons, template and shortTemplate are set by Config.build.
+	icons         IconSet
+	template      *template.Template
+	shortTemplate *template.Template
+}
+
+// Duration is a time.Duration that is represented in configuration as a
+// string, e.g. "10s" or "1m30s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
+
+// configPath returns the default location of the configuration file,
+// following the XDG base directory specification.
+func configPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find home directory: %w", err)
+		}
+
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, configDirName, configFileName), nil
+}
+
+// loadConfig reads and validates the configuration file at the given path.
+// If the path is empty, the default location is used, and a missing file
+// results in the default configuration.
+func loadConfig(path string) (*Config, error) {
+	explicit := path != ""
+
+	if !explicit {
+		p, err := configPath()
+		if err != nil {
+			return nil, err
+		}
+		path = p
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			cfg := defaultConfig
+			return &cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	cfg, err := parseConfig(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func parseConfig(b []byte) (*Config, error) {
+	var cfg Config
+
+	if err := decodeStrict(b, &cfg); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Modules) == 0 {
+		return nil, errors.New("no modules configured")
+	}
+
+	if _, err := loadTheme(cfg.Theme); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Log.validate(); err != nil {
+		return nil, fmt.Errorf("log: %w", err)
+	}
+
+	if _, err := cfg.build(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// build creates the status functions for every configured module, reporting
+// unknown modules and invalid options.
+func (c *Config) build() ([]statusFunc, error) {
+	funcs := make([]statusFunc, 0, len(c.Modules))
+	names := make(map[string]bool, len(c.Modules))
+
+	icons, err := loadIconSet(c.Icons, c.IconOverrides)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range c.Modules {
+		mc := &c.Modules[i]
+
+		typ, ok := modules[mc.Module]
+		if !ok {
+			return nil, fmt.Errorf("module %d: unknown module %q", i, mc.Module)
+		}
+
+		mc.icons = icons
+
+		name := mc.name()
+		if names[name] {
+			return nil, fmt.Errorf("module %d (%s): duplicate name %q", i, mc.Module, name)
+		}
+		names[name] = true
+
+		if mc.Markup != "" && mc.Markup != markupNone && mc.Markup != markupPango {
+			return nil, fmt.Errorf("module %d (%s): unknown markup %q", i, mc.Module, mc.Markup)
+		}
+
+		if mc.Template != "" || mc.ShortTemplate != "" {
+			if typ.data == nil {
+				return nil, fmt.Errorf("module %d (%s): templates aren't supported", i, mc.Module)
+			}
+
+			if mc.template, err = parseTemplate(mc.name()+".template", mc.Template, typ.data); err != nil {
+				return nil, fmt.Errorf("module %d (%s): %w", i, mc.Module, err)
+			}
+			if mc.shortTemplate, err = parseTemplate(mc.name()+".short_template", mc.ShortTemplate, typ.data); err != nil {
+				return nil, fmt.Errorf("module %d (%s): %w", i, mc.Module, err)
+			}
+		}
+
+		if mc.Signal < 0 || mc.Signal > maxRefreshSignal {
+			return nil, fmt.Errorf("module %d (%s): signal must be between 1 and %d", i, mc.Module, maxRefreshSignal)
+		}
+
+		for j := range mc.Clicks {
+			if err := mc.Clicks[j].validate(typ.actions); err != nil {
+				return nil, fmt.Errorf("module %d (%s): click %d: %w", i, mc.Module, j, err)
+			}
+		}
+
+		fn, err := typ.new(mc)
+		if err != nil {
+			return nil, fmt.Errorf("module %d (%s): %w", i, mc.Module, err)
+		}
+
+		funcs = append(funcs, fn)
+	}
+
+	return funcs, nil
+}
+
+// only removes every module whose name isn't in names.
+func (c *Config) only(names []string) error {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[strings.TrimSpace(name)] = true
+	}
+
+	var modules []ModuleConfig
+	for _, mc := range c.Modules {
+		if keep[mc.name()] {
+			modules = append(modules, mc)
+			delete(keep, mc.name())
+		}
+	}
+
+	for name := range keep {
+		return fmt.Errorf("no module named %q", name)
+	}
+
+	c.Modules = modules
+
+	return nil
+}
+
+// name returns the block name used by the module.
+func (mc *ModuleConfig) name() string {
+	if mc.Name != "" {
+		return mc.Name
+	}
+	return mc.Module
+}
+
+// module returns the configuration shared by every kind of module.
+func (mc *ModuleConfig) module() module {
+	return module{
+		name:          mc.name(),
+		pango:         mc.Markup == markupPango,
+		icons:         mc.icons,
+		template:      mc.template,
+		shortTemplate: mc.shortTemplate,
+		log:           logging.New(mc.name()),
+	}
+}
+
+// position returns the module's position on the bar, given its index in the
+// configuration file.
+func (mc *ModuleConfig) position(index int) int {
+	if mc.Position != nil {
+		return *mc.Position
+	}
+	return index
+}
+
+// decodeOptions decodes module options into v, rejecting unknown keys.  Empty
+// options leave v untouched, so it should be filled with defaults first.
+func (mc *ModuleConfig) decodeOptions(v interface{}) error {
+	if len(mc.Options) == 0 {
+		return nil
+	}
+
+	if err := decodeStrict(mc.Options, v); err != nil {
+		return fmt.Errorf("invalid options: %w", err)
+	}
+
+	return nil
+}
+
+func decodeStrict(b []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+
+	return decoder.Decode(v)
+}
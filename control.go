@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tom5760/swaybar-status/logging"
+)
+
+const (
+	controlSocketName = "swaybar-status.sock"
+
+	// controlMaxLine limits the size of a request.
+	controlMaxLine = 64 * 1024
+)
+
+// Commands accepted by the control socket.
+const (
+	controlUpdate    = "update"
+	controlRemove    = "remove"
+	controlUrgent    = "urgent"
+	controlSubscribe = "subscribe"
+	controlReload    = "reload"
+)
+
+// ControlRequest is sent to the control socket as a line of JSON.
+type ControlRequest struct {
+	// Command is one of "update", "remove", "urgent", "subscribe" or
+	// "reload".
+	Command string `json:"command"`
+
+	// Block is inserted or updated by the update command.
+	Block *Block `json:"block,omitempty"`
+
+	// State is the state of the block for the update command, e.g. "warning".
+	State string `json:"state,omitempty"`
+
+	// Name and Instance identify the block for the other commands.
+	Name     string `json:"name,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Urgent is the urgency set by the urgent command.
+	Urgent bool `json:"urgent,omitempty"`
+
+	// TTL limits how long an updated block, or its urgency, lasts.
+	TTL Duration `json:"ttl,omitempty"`
+}
+
+// ControlResponse is sent back as a line of JSON for each request, and for
+// each click event on subscribed blocks.
+type ControlResponse struct {
+	Error string      `json:"error,omitempty"`
+	Event *ClickEvent `json:"event,omitempty"`
+}
+
+type controlOptions struct {
+	// Path is the path of the socket.  Defaults to swaybar-status.sock in
+	// $XDG_RUNTIME_DIR.
+	Path string `json:"path"`
+}
+
+func newControlModule(mc *ModuleConfig) (statusFunc, error) {
+	var opts controlOptions
+
+	if err := mc.decodeOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	m := mc.module()
+
+	return func(ctx context.Context, sb *StatusBar) error {
+		path := opts.Path
+		if path == "" {
+			p, err := controlSocketPath()
+			if err != nil {
+				return err
+			}
+			path = p
+		}
+
+		return statusControl(ctx, sb, m, path)
+	}, nil
+}
+
+// controlSocketPath returns the default path of the control socket.
+func controlSocketPath() (string, error) {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return "", errors.New("XDG_RUNTIME_DIR is not set")
+	}
+
+	return filepath.Join(dir, controlSocketName), nil
+}
+
+// controlServer manages the blocks added through the control socket.
+type controlServer struct {
+	sb *StatusBar
+	m  module
+
+	lock sync.Mutex
+
+	// blocks are the blocks as last sent, and urgent overrides their urgency.
+	blocks map[BlockKey]Block
+	urgent map[BlockKey]bool
+
+	expiries       map[BlockKey]*time.Timer
+	urgentExpiries map[BlockKey]*time.Timer
+
+	subs map[BlockKey]map[*controlConn]bool
+
+	// claimed are the block names owned by the server, while it has blocks
+	// or subscriptions with that name.
+	claimed map[string]bool
+}
+
+func newControlServer(sb *StatusBar, m module) *controlServer {
+	return &controlServer{
+		sb:             sb,
+		m:              m,
+		blocks:         make(map[BlockKey]Block),
+		urgent:         make(map[BlockKey]bool),
+		expiries:       make(map[BlockKey]*time.Timer),
+		urgentExpiries: make(map[BlockKey]*time.Timer),
+		subs:           make(map[BlockKey]map[*controlConn]bool),
+		claimed:        make(map[string]bool),
+	}
+}
+
+// controlConn is a client connection.  Responses and click events may be
+// written concurrently.
+type controlConn struct {
+	lock    sync.Mutex
+	conn    net.Conn
+	encoder *json.Encoder
+}
+
+func (c *controlConn) send(resp ControlResponse) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err := c.encoder.Encode(resp); err != nil {
+		logging.Warn("failed to write control response", "err", err)
+	}
+}
+
+func statusControl(ctx context.Context, sb *StatusBar, m module, path string) error {
+	listener, err := listenUnix(path)
+	if err != nil {
+		return err
+	}
+
+	srv := newControlServer(sb, m)
+
+	defer srv.clear()
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept control connection: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			srv.serve(ctx, conn)
+		}()
+	}
+}
+
+// listenUnix listens on a unix socket, replacing a stale socket left by a
+// previous process.
+func listenUnix(path string) (*net.UnixListener, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("control socket %s is already in use", path)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+	}
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+
+	// Remove the socket file when the listener is closed.
+	listener.SetUnlinkOnClose(true)
+
+	return listener, nil
+}
+
+func (srv *controlServer) serve(ctx context.Context, conn net.Conn) {
+	// The connection is closed on shutdown, or once the client is done.
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	cc := &controlConn{
+		conn:    conn,
+		encoder: json.NewEncoder(conn),
+	}
+
+	defer srv.unsubscribe(cc)
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), controlMaxLine)
+
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var resp ControlResponse
+
+		var req ControlRequest
+		if err := decodeStrict(scanner.Bytes(), &req); err != nil {
+			resp.Error = fmt.Sprintf("invalid request: %v", err)
+		} else if err := srv.handle(cc, &req); err != nil {
+			resp.Error = err.Error()
+		}
+
+		cc.send(resp)
+	}
+
+	// Connections are closed on shutdown, which isn't worth logging.
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		srv.m.log.Warn("failed to read control connection", "err", err)
+	}
+}
+
+func (srv *controlServer) handle(cc *controlConn, req *ControlRequest) error {
+	switch req.Command {
+	case controlUpdate:
+		if req.Block == nil {
+			return errors.New("update requires a block")
+		}
+
+		block := *req.Block
+
+		if req.State != "" {
+			state, err := parseState(req.State)
+			if err != nil {
+				return err
+			}
+			block.State = state
+		}
+
+		return srv.update(block, time.Duration(req.TTL))
+
+	case controlRemove:
+		return srv.remove(BlockKey{Name: req.Name, Instance: req.Instance})
+
+	case controlUrgent:
+		return srv.setUrgent(BlockKey{Name: req.Name, Instance: req.Instance}, req.Urgent, time.Duration(req.TTL))
+
+	case controlSubscribe:
+		return srv.subscribe(cc, BlockKey{Name: req.Name, Instance: req.Instance})
+
+	case controlReload:
+		// The configuration is applied after responding, as it may restart
+		// this module.
+		return srv.sb.Reload()
+
+	default:
+		return fmt.Errorf("unknown command %q", req.Command)
+	}
+}
+
+// claim checks that a block name isn't used by a module, and places blocks
+// with that name where the control module is configured.  Must be called
+// with the lock held.
+func (srv *controlServer) claim(name string) error {
+	if name == "" {
+		return errors.New("block has no name")
+	}
+
+	if srv.claimed[name] {
+		return nil
+	}
+
+	if _, ok := srv.sb.Position(name); ok {
+		return fmt.Errorf("block name %q is used by a module", name)
+	}
+
+	position, _ := srv.sb.Position(srv.m.name)
+	srv.sb.SetPosition(name, position)
+	srv.claimed[name] = true
+
+	return nil
+}
+
+// release gives up a block name once the server has no blocks or
+// subscriptions left with that name.  Must be called with the lock held.
+func (srv *controlServer) release(name string) {
+	if !srv.claimed[name] {
+		return
+	}
+
+	for key := range srv.blocks {
+		if key.Name == name {
+			return
+		}
+	}
+	for key := range srv.subs {
+		if key.Name == name {
+			return
+		}
+	}
+
+	delete(srv.claimed, name)
+	srv.sb.ClearPosition(name)
+}
+
+func (srv *controlServer) update(block Block, ttl time.Duration) error {
+	key := block.Key()
+
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if err := srv.claim(key.Name); err != nil {
+		return err
+	}
+
+	if _, ok := srv.blocks[key]; !ok {
+		srv.sb.OnClick(key, srv.click)
+	}
+
+	srv.blocks[key] = block
+	srv.render(key)
+
+	if timer, ok := srv.expiries[key]; ok {
+		timer.Stop()
+		delete(srv.expiries, key)
+	}
+
+	if ttl > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(ttl, func() {
+			srv.lock.Lock()
+			defer srv.lock.Unlock()
+
+			// The block may have been updated while waiting for the lock,
+			// replacing this timer.
+			if srv.expiries[key] != timer {
+				return
+			}
+
+			srv.removeLocked(key)
+		})
+		srv.expiries[key] = timer
+	}
+
+	return nil
+}
+
+func (srv *controlServer) remove(key BlockKey) error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if _, ok := srv.blocks[key]; !ok {
+		return fmt.Errorf("no block %q with instance %q", key.Name, key.Instance)
+	}
+
+	srv.removeLocked(key)
+
+	return nil
+}
+
+func (srv *controlServer) removeLocked(key BlockKey) {
+	for _, timers := range []map[BlockKey]*time.Timer{srv.expiries, srv.urgentExpiries} {
+		if timer, ok := timers[key]; ok {
+			timer.Stop()
+			delete(timers, key)
+		}
+	}
+
+	delete(srv.blocks, key)
+	delete(srv.urgent, key)
+
+	srv.sb.Remove(key)
+	srv.release(key.Name)
+}
+
+func (srv *controlServer) setUrgent(key BlockKey, urgent bool, ttl time.Duration) error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if _, ok := srv.blocks[key]; !ok {
+		return fmt.Errorf("no block %q with instance %q", key.Name, key.Instance)
+	}
+
+	srv.urgent[key] = urgent
+	srv.render(key)
+
+	if timer, ok := srv.urgentExpiries[key]; ok {
+		timer.Stop()
+		delete(srv.urgentExpiries, key)
+	}
+
+	if ttl > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(ttl, func() {
+			srv.lock.Lock()
+			defer srv.lock.Unlock()
+
+			// The urgency may have been set again while waiting for the
+			// lock, replacing this timer.
+			if srv.urgentExpiries[key] != timer {
+				return
+			}
+
+			delete(srv.urgent, key)
+			delete(srv.urgentExpiries, key)
+
+			if _, ok := srv.blocks[key]; ok {
+				srv.render(key)
+			}
+		})
+		srv.urgentExpiries[key] = timer
+	}
+
+	return nil
+}
+
+// render updates the bar with a block and its urgency override.  Must be
+// called with the lock held.
+func (srv *controlServer) render(key BlockKey) {
+	block := srv.blocks[key]
+
+	if urgent, ok := srv.urgent[key]; ok {
+		block.Urgent = urgent
+	}
+
+	srv.sb.Update(block)
+}
+
+func (srv *controlServer) subscribe(cc *controlConn, key BlockKey) error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if err := srv.claim(key.Name); err != nil {
+		return err
+	}
+
+	conns, ok := srv.subs[key]
+	if !ok {
+		conns = make(map[*controlConn]bool)
+		srv.subs[key] = conns
+	}
+
+	conns[cc] = true
+	srv.sb.OnClick(key, srv.click)
+
+	return nil
+}
+
+func (srv *controlServer) unsubscribe(cc *controlConn) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	for key, conns := range srv.subs {
+		delete(conns, cc)
+		if len(conns) == 0 {
+			delete(srv.subs, key)
+			srv.release(key.Name)
+		}
+	}
+}
+
+// click forwards click events to the connections subscribed to the block.
+func (srv *controlServer) click(ctx context.Context, evt ClickEvent) {
+	key := BlockKey{Name: evt.Name, Instance: evt.Instance}
+
+	srv.lock.Lock()
+	conns := make([]*controlConn, 0, len(srv.subs[key]))
+	for cc := range srv.subs[key] {
+		conns = append(conns, cc)
+	}
+	srv.lock.Unlock()
+
+	for _, cc := range conns {
+		e := evt
+		cc.send(ControlResponse{Event: &e})
+	}
+}
+
+// clear removes every block added through the socket.
+func (srv *controlServer) clear() {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	for key := range srv.blocks {
+		srv.removeLocked(key)
+	}
+
+	for name := range srv.claimed {
+		delete(srv.claimed, name)
+		srv.sb.ClearPosition(name)
+	}
+}
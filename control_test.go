@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/tom5760/swaybar-status/logging"
+)
+
+func newTestControlServer() (*StatusBar, *controlServer) {
+	sb := NewStatusBar(nil)
+	sb.SetPosition("control", 3)
+	sb.SetPosition("time", 5)
+
+	m := module{name: "control", log: logging.New("control")}
+
+	return sb, newControlServer(sb, m)
+}
+
+// hasBlock reports whether the bar has a block with the given key.
+func hasBlock(sb *StatusBar, key BlockKey) bool {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+
+	_, ok := sb.blockMap[key]
+	return ok
+}
+
+func TestControlClaimsModuleName(t *testing.T) {
+	_, srv := newTestControlServer()
+
+	err := srv.update(Block{Name: "time", FullText: "x"}, 0)
+	if err == nil {
+		t.Fatal("update with a module's name succeeded")
+	}
+}
+
+func TestControlReaddRemovedBlock(t *testing.T) {
+	sb, srv := newTestControlServer()
+	key := BlockKey{Name: "vpn"}
+
+	if err := srv.update(Block{Name: "vpn", FullText: "up"}, 0); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	if position, ok := sb.Position("vpn"); !ok || position != 3 {
+		t.Errorf("position = %d, %v; want 3, true", position, ok)
+	}
+
+	if err := srv.remove(key); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	if _, ok := sb.Position("vpn"); ok {
+		t.Error("position kept after removing the last block")
+	}
+
+	if err := srv.update(Block{Name: "vpn", FullText: "up again"}, 0); err != nil {
+		t.Fatalf("update after remove: %v", err)
+	}
+
+	if !hasBlock(sb, key) {
+		t.Error("block missing after update")
+	}
+}
+
+func TestControlReaddExpiredBlock(t *testing.T) {
+	sb, srv := newTestControlServer()
+	key := BlockKey{Name: "vpn", Instance: "wg0"}
+
+	if err := srv.update(Block{Name: "vpn", Instance: "wg0", FullText: "up"}, 10*time.Millisecond); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for hasBlock(sb, key) {
+		if time.Now().After(deadline) {
+			t.Fatal("block didn't expire")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := srv.update(Block{Name: "vpn", Instance: "wg0", FullText: "up again"}, 0); err != nil {
+		t.Fatalf("update after expiry: %v", err)
+	}
+
+	if !hasBlock(sb, key) {
+		t.Error("block missing after update")
+	}
+}
+
+func TestControlKeepsNameWhileSubscribed(t *testing.T) {
+	sb, srv := newTestControlServer()
+	cc := &controlConn{}
+
+	if err := srv.subscribe(cc, BlockKey{Name: "vpn"}); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if err := srv.update(Block{Name: "vpn", FullText: "up"}, 0); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := srv.remove(BlockKey{Name: "vpn"}); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	if _, ok := sb.Position("vpn"); !ok {
+		t.Error("position released while still subscribed")
+	}
+
+	srv.unsubscribe(cc)
+
+	if _, ok := sb.Position("vpn"); ok {
+		t.Error("position kept after unsubscribing")
+	}
+}
+
+func TestControlClearReleasesNames(t *testing.T) {
+	sb, srv := newTestControlServer()
+
+	if err := srv.update(Block{Name: "vpn", FullText: "up"}, 0); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	srv.clear()
+
+	if _, ok := sb.Position("vpn"); ok {
+		t.Error("position kept after clear")
+	}
+
+	// A restarted control module can use the name again.
+	srv = newControlServer(sb, srv.m)
+
+	if err := srv.update(Block{Name: "vpn", FullText: "up"}, 0); err != nil {
+		t.Fatalf("update after restart: %v", err)
+	}
+}
+
+func TestControlServeReleasesConnection(t *testing.T) {
+	_, srv := newTestControlServer()
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 10; i++ {
+		client, conn := net.Pipe()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			srv.serve(context.Background(), conn)
+		}()
+
+		client.Close()
+		<-done
+	}
+
+	// Nothing is left waiting for the bar to stop.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left after serving connections", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
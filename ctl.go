@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+const ctlUsage = `usage: %s ctl <command> [flags]
+
+Commands:
+  update     add or update a block
+  remove     remove a block
+  urgent     set the urgency of a block
+  subscribe  print click events on a block, as lines of JSON
+  reload     reload the configuration, keeping the current one if it's invalid
+  raw        send requests from standard input, printing the responses
+
+Flags:
+`
+
+// ctl talks to the control socket of a running status bar.
+func ctl(args []string) error {
+	flags := flag.NewFlagSet("ctl", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), ctlUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	var (
+		socketFlag   = flags.String("socket", "", "path to the control socket")
+		nameFlag     = flags.String("name", "", "name of the block")
+		instanceFlag = flags.String("instance", "", "instance of the block")
+		textFlag     = flags.String("text", "", "full text of the block")
+		shortFlag    = flags.String("short", "", "short text of the block")
+		colorFlag    = flags.String("color", "", "text color of the block")
+		stateFlag    = flags.String("state", "", "state of the block: idle, info, good, warning or critical")
+		markupFlag   = flags.String("markup", "", "markup of the block text: none or pango")
+		urgentFlag   = flags.Bool("urgent", false, "mark the block as urgent; the urgent command defaults to true")
+		ttlFlag      = flags.Duration("ttl", 0, "remove the block, or reset its urgency, after this long")
+	)
+
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	command := args[0]
+	flags.Parse(args[1:])
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	path := *socketFlag
+	if path == "" {
+		p, err := controlSocketPath()
+		if err != nil {
+			return err
+		}
+		path = p
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to connect to control socket: %w", err)
+	}
+	defer conn.Close()
+
+	req := ControlRequest{
+		Command:  command,
+		Name:     *nameFlag,
+		Instance: *instanceFlag,
+		TTL:      Duration(*ttlFlag),
+	}
+
+	switch req.Command {
+	case "raw":
+		return ctlRaw(conn)
+
+	case controlUpdate:
+		req.Block = &Block{
+			Name:      *nameFlag,
+			Instance:  *instanceFlag,
+			FullText:  *textFlag,
+			ShortText: *shortFlag,
+			Color:     *colorFlag,
+			Markup:    *markupFlag,
+			Urgent:    *urgentFlag,
+		}
+		req.State = *stateFlag
+		req.Name = ""
+		req.Instance = ""
+
+	case controlUrgent:
+		req.Urgent = true
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "urgent" {
+				req.Urgent = *urgentFlag
+			}
+		})
+	}
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	decoder := json.NewDecoder(conn)
+
+	var resp ControlResponse
+	if err := decoder.Decode(&resp); err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	if req.Command != controlSubscribe {
+		return nil
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+
+	for {
+		var resp ControlResponse
+		if err := decoder.Decode(&resp); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read event: %w", err)
+		}
+
+		if resp.Event == nil {
+			continue
+		}
+
+		if err := encoder.Encode(resp.Event); err != nil {
+			return fmt.Errorf("failed to write event: %w", err)
+		}
+	}
+}
+
+// ctlRaw copies requests from standard input to the socket, and everything
+// the socket sends to standard output.
+func ctlRaw(conn net.Conn) error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(os.Stdout, conn)
+		done <- err
+	}()
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 4096), controlMaxLine)
+
+	for scanner.Scan() {
+		line := append(scanner.Bytes(), '\n')
+		if _, err := conn.Write(line); err != nil {
+			return fmt.Errorf("failed to send request: %w", err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read requests: %w", err)
+	}
+
+	// The status bar closes the connection once it has responded to every
+	// request.
+	if err := conn.(*net.UnixConn).CloseWrite(); err != nil {
+		return fmt.Errorf("failed to close requests: %w", err)
+	}
+
+	return <-done
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+const (
+	daemonMaxLine = 64 * 1024
+
+	// daemonClickQueue is how many click events may wait to be written to
+	// the process before further clicks are dropped.
+	daemonClickQueue = 16
+
+	// daemonStopTimeout is how long the process may take to exit after
+	// SIGTERM before it is killed.
+	daemonStopTimeout = 5 * time.Second
+)
+
+var (
+	daemonActions = []string{"send"}
+
+	// By default, every click is sent to the process.
+	daemonBindings = []ClickBinding{
+		{Button: anyButton, Action: "send"},
+	}
+)
+
+type daemonOptions struct {
+	// Command is run with sh -c, and keeps running.  Each line it prints is
+	// either a block or an array of blocks in the swaybar protocol, replacing
+	// the module's blocks.  The name of the blocks is set to the module's.
+	// Clicks are written to its standard input as a click event per line.
+	Command string `json:"command"`
+
+	// MaxLine is the longest line, in bytes, that the process may print.
+	MaxLine int `json:"max_line"`
+}
+
+func newDaemonModule(mc *ModuleConfig) (statusFunc, error) {
+	opts := daemonOptions{
+		MaxLine: daemonMaxLine,
+	}
+
+	if err := mc.decodeOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	if opts.Command == "" {
+		return nil, errors.New("command must be set")
+	}
+
+	if opts.MaxLine <= 0 {
+		return nil, errors.New("max_line must be positive")
+	}
+
+	m := mc.module()
+
+	return func(ctx context.Context, sb *StatusBar) error {
+		return statusDaemon(ctx, sb, m, opts)
+	}, nil
+}
+
+// statusDaemon runs the module's process until it exits, which is reported
+// as an error so that it is restarted with backoff.
+func statusDaemon(ctx context.Context, sb *StatusBar, m module, opts daemonOptions) error {
+	cmd := exec.Command("sh", "-c", opts.Command)
+	cmd.Env = append(os.Environ(), "BLOCK_NAME="+m.name)
+	cmd.Stderr = os.Stderr
+
+	// Run the process in its own process group, so that everything it
+	// started is stopped with it.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start process: %w", err)
+	}
+
+	procCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	exited := make(chan struct{})
+	defer close(exited)
+
+	go func() {
+		<-procCtx.Done()
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+
+		// A process that left the group may still hold the pipe open, which
+		// would keep the read loop waiting.
+		stdout.Close()
+
+		select {
+		case <-exited:
+		case <-time.After(daemonStopTimeout):
+			m.log.Warn("process didn't exit, killing it")
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+	}()
+
+	clicks := make(chan ClickEvent, daemonClickQueue)
+	go writeDaemonClicks(procCtx, m, stdin, clicks)
+
+	readErr := readDaemonBlocks(procCtx, sb, m, stdout, opts.MaxLine, clicks)
+
+	// Stop the process if it closed its output without exiting.
+	cancel()
+	waitErr := cmd.Wait()
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	if readErr != nil {
+		return readErr
+	}
+
+	if waitErr != nil {
+		return fmt.Errorf("process exited: %w", waitErr)
+	}
+
+	return errors.New("process exited")
+}
+
+// readDaemonBlocks updates the bar with each line of blocks from the process,
+// until its output is closed.
+func readDaemonBlocks(ctx context.Context, sb *StatusBar, m module, r io.Reader, maxLine int, clicks chan<- ClickEvent) error {
+	actions := map[string]ClickFunc{
+		"send": func(ctx context.Context, evt ClickEvent) {
+			select {
+			case clicks <- evt:
+			default:
+				m.log.Warn("dropped click, process isn't reading", "instance", evt.Instance)
+			}
+		},
+	}
+
+	current := make(map[BlockKey]bool)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxLine)
+
+	for scanner.Scan() {
+		blocks, err := parseDaemonLine(scanner.Bytes())
+		if err != nil {
+			m.log.Warn("invalid blocks from process", "err", err)
+			continue
+		}
+
+		if blocks == nil {
+			continue
+		}
+
+		next := make(map[BlockKey]bool, len(blocks))
+
+		for _, block := range blocks {
+			block.Name = m.name
+			key := block.Key()
+
+			if !current[key] {
+				sb.BindActions(key, actions, daemonBindings)
+			}
+
+			next[key] = true
+			sb.Update(block)
+		}
+
+		for key := range current {
+			if !next[key] {
+				sb.Remove(key)
+			}
+		}
+
+		current = next
+	}
+
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to read process output: %w", err)
+	}
+
+	return nil
+}
+
+// parseDaemonLine parses a line of output, which is either a block or an
+// array of blocks.  Blank lines result in nil blocks.
+func parseDaemonLine(line []byte) ([]Block, error) {
+	line = bytes.TrimSpace(line)
+
+	switch {
+	case len(line) == 0:
+		return nil, nil
+
+	case line[0] == '[':
+		blocks := []Block{}
+		if err := json.Unmarshal(line, &blocks); err != nil {
+			return nil, fmt.Errorf("invalid blocks: %w", err)
+		}
+		return blocks, nil
+
+	default:
+		var block Block
+		if err := json.Unmarshal(line, &block); err != nil {
+			return nil, fmt.Errorf("invalid block: %w", err)
+		}
+		return []Block{block}, nil
+	}
+}
+
+// writeDaemonClicks writes click events to the process, one per line.
+func writeDaemonClicks(ctx context.Context, m module, w io.WriteCloser, clicks <-chan ClickEvent) {
+	defer w.Close()
+
+	encoder := json.NewEncoder(w)
+
+	for {
+		select {
+		case evt := <-clicks:
+			if err := encoder.Encode(evt); err != nil {
+				m.log.Warn("failed to send click", "err", err)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -71,8 +71,9 @@ type Block struct {
 	Urgent bool `json:"urgent,omitempty"`
 
 	// Whether the bar separator should be drawn after the block. See sway-bar(5)
-	// for more information on how to set the separator text.
-	Separator bool `json:"separator,omitempty"`
+	// for more information on how to set the separator text.  If nil, the
+	// separator is drawn.
+	Separator *bool `json:"separator,omitempty"`
 
 	// The amount of pixels to leave blank after the block. The separator text
 	// will be displayed centered in this gap. The default is 9 pixels.
@@ -81,6 +82,14 @@ type Block struct {
 	// The type of markup to use when parsing the text for the block. This can
 	// either be pango or none (default).
 	Markup string `json:"markup,omitempty"`
+
+	// State is the semantic state of the block, which the theme maps to
+	// colors.  It isn't sent to swaybar.
+	State State `json:"-"`
+
+	// Percentage is a value between 0 and 100 shown by outputs that support
+	// it, e.g. the battery charge.  It isn't sent to swaybar.
+	Percentage int `json:"-"`
 }
 
 type BlockKey struct {
@@ -95,23 +104,23 @@ func (b *Block) Key() BlockKey {
 // ClickEvents are reported if requested in the header.
 type ClickEvent struct {
 	// The name of the block, if set.
-	Name string
+	Name string `json:"name,omitempty"`
 
 	// The instance of the block, if set.
-	Instance string
+	Instance string `json:"instance,omitempty"`
 
 	// The x location that the click occurred at.
-	X int
+	X int `json:"x"`
 
 	// The y location that the click occurred at.
-	Y int
+	Y int `json:"y"`
 
 	// The x11 button number for the click. If the button does not have an x11
 	// button mapping, this will be 0.
-	Button int
+	Button int `json:"button"`
 
 	// The event code that corresponds to the button for the click
-	Event int
+	Event int `json:"event,omitempty"`
 
 	// The x location of the click relative to the top-left of the block.
 	RelativeX int `json:"relative_x"`
@@ -120,8 +129,56 @@ type ClickEvent struct {
 	RelativeY int `json:"relative_y"`
 
 	// The width of the block in pixels
-	Width int
+	Width int `json:"width"`
 
 	// The height of the block in pixels
-	Height int
+	Height int `json:"height"`
+
+	// The scale of the output the bar is displayed on.
+	Scale float64 `json:"scale,omitempty"`
+
+	// The modifier keys held during the click, e.g. "Shift" or "Mod4".  Sent
+	// by i3bar; swaybar currently leaves it empty.
+	Modifiers []string `json:"modifiers,omitempty"`
+}
+
+// Modifier names sent in click events.
+const (
+	ModShift   = "Shift"
+	ModControl = "Control"
+	ModMod1    = "Mod1"
+	ModMod2    = "Mod2"
+	ModMod3    = "Mod3"
+	ModMod4    = "Mod4"
+	ModMod5    = "Mod5"
+	ModLock    = "Lock"
+)
+
+// HasModifiers reports whether exactly the given modifiers were held during
+// the click.  Lock modifiers (caps lock and num lock) are ignored.
+func (e *ClickEvent) HasModifiers(mods ...string) bool {
+	held := make(map[string]bool, len(e.Modifiers))
+	for _, mod := range e.Modifiers {
+		if mod == ModLock || mod == ModMod2 {
+			continue
+		}
+		held[mod] = true
+	}
+
+	want := make(map[string]bool, len(mods))
+	for _, mod := range mods {
+		want[mod] = true
+	}
+
+	if len(held) != len(want) {
+		return false
+	}
+
+	for mod := range want {
+		if !held[mod] {
+			return false
+		}
+	}
+
+	return true
 }
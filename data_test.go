@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeClickEvent(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want ClickEvent
+	}{
+		{
+			name: "swaybar",
+			json: `{ "name": "time", "instance": "", "button": 1, "event": 272, "x": 1805, "y": 12, "relative_x": 45, "relative_y": 12, "width": 110, "height": 24, "scale": 1 }`,
+			want: ClickEvent{Name: "time", Button: 1, Event: 272, X: 1805, Y: 12, RelativeX: 45, RelativeY: 12, Width: 110, Height: 24, Scale: 1},
+		},
+		{
+			name: "swaybar fractional scale",
+			json: `{ "name": "volume", "instance": "sink", "button": 4, "event": 768, "x": 1500, "y": 8, "relative_x": 20, "relative_y": 8, "width": 60, "height": 18, "scale": 1.5 }`,
+			want: ClickEvent{Name: "volume", Instance: "sink", Button: 4, Event: 768, X: 1500, Y: 8, RelativeX: 20, RelativeY: 8, Width: 60, Height: 18, Scale: 1.5},
+		},
+		{
+			name: "swaybar without scale",
+			json: `{ "name": "battery", "button": 3, "event": 273, "x": 1700, "y": 10, "relative_x": 5, "relative_y": 10, "width": 80, "height": 24 }`,
+			want: ClickEvent{Name: "battery", Button: 3, Event: 273, X: 1700, Y: 10, RelativeX: 5, RelativeY: 10, Width: 80, Height: 24},
+		},
+		{
+			name: "i3bar",
+			json: `{"name":"network","instance":"wlan0","button":1,"modifiers":["Mod2"],"x":1287,"y":1063,"relative_x":41,"relative_y":11,"output_x":1287,"output_y":17,"width":112,"height":22}`,
+			want: ClickEvent{Name: "network", Instance: "wlan0", Button: 1, Modifiers: []string{ModMod2}, X: 1287, Y: 1063, RelativeX: 41, RelativeY: 11, Width: 112, Height: 22},
+		},
+		{
+			name: "i3bar with modifiers",
+			json: `{"name":"player","instance":"org.mpris.MediaPlayer2.spotify","button":3,"modifiers":["Shift","Mod2","Control"],"x":900,"y":1070,"relative_x":12,"relative_y":4,"output_x":900,"output_y":4,"width":200,"height":22}`,
+			want: ClickEvent{Name: "player", Instance: "org.mpris.MediaPlayer2.spotify", Button: 3, Modifiers: []string{ModShift, ModMod2, ModControl}, X: 900, Y: 1070, RelativeX: 12, RelativeY: 4, Width: 200, Height: 22},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got ClickEvent
+			if err := json.Unmarshal([]byte(test.json), &got); err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v; want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestClickEventHasModifiers(t *testing.T) {
+	tests := []struct {
+		held []string
+		want []string
+		ok   bool
+	}{
+		{held: nil, want: nil, ok: true},
+		{held: []string{ModMod2}, want: nil, ok: true},
+		{held: []string{ModLock, ModMod2}, want: nil, ok: true},
+		{held: []string{ModShift}, want: nil, ok: false},
+		{held: []string{ModShift}, want: []string{ModShift}, ok: true},
+		{held: []string{ModShift, ModLock}, want: []string{ModShift}, ok: true},
+		{held: []string{ModControl, ModMod2, ModShift}, want: []string{ModShift, ModControl}, ok: true},
+		{held: []string{ModShift, ModControl}, want: []string{ModShift}, ok: false},
+		{held: []string{ModShift}, want: []string{ModShift, ModControl}, ok: false},
+		{held: nil, want: []string{ModMod4}, ok: false},
+	}
+
+	for _, test := range tests {
+		evt := ClickEvent{Modifiers: test.held}
+		if got := evt.HasModifiers(test.want...); got != test.ok {
+			t.Errorf("%v.HasModifiers(%v) = %v; want %v", test.held, test.want, got, test.ok)
+		}
+	}
+}
+
+func TestClickMuxServeClick(t *testing.T) {
+	var got string
+	handler := func(name string) ClickFunc {
+		return func(ctx context.Context, evt ClickEvent) {
+			got = name
+		}
+	}
+
+	var mux ClickMux
+	mux.Handle(1, handler("left"))
+	mux.Handle(1, handler("shift-left"), ModShift)
+	mux.Handle(3, handler("ctrl-shift-right"), ModControl, ModShift)
+	mux.Handle(anyButton, handler("any"))
+
+	tests := []struct {
+		evt  ClickEvent
+		want string
+	}{
+		{ClickEvent{Button: 1}, "left"},
+		{ClickEvent{Button: 1, Modifiers: []string{ModMod2}}, "left"},
+		{ClickEvent{Button: 1, Modifiers: []string{ModShift}}, "shift-left"},
+		{ClickEvent{Button: 1, Modifiers: []string{ModShift, ModLock}}, "shift-left"},
+		{ClickEvent{Button: 3, Modifiers: []string{ModShift, ModControl}}, "ctrl-shift-right"},
+		{ClickEvent{Button: 3}, "any"},
+		{ClickEvent{Button: 1, Modifiers: []string{ModControl}}, "any"},
+		{ClickEvent{Button: 5, Modifiers: []string{ModMod4}}, "any"},
+	}
+
+	for _, test := range tests {
+		got = ""
+		mux.ServeClick(context.Background(), test.evt)
+
+		if got != test.want {
+			t.Errorf("button %d with %v: got handler %q; want %q", test.evt.Button, test.evt.Modifiers, got, test.want)
+		}
+	}
+
+	// Without an anyButton route, unmatched clicks are ignored.
+	var strict ClickMux
+	strict.Handle(1, handler("left"))
+
+	got = ""
+	strict.ServeClick(context.Background(), ClickEvent{Button: 2})
+
+	if got != "" {
+		t.Errorf("unmatched click handled by %q", got)
+	}
+}
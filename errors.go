@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	errorIcon = "⚠"
+
+	// errorColor is used for critical blocks by the default theme.
+	errorColor = "#FF5555"
+
+	// errorInstance is the instance of a module's error block, so that it
+	// doesn't collide with the module's own blocks.
+	errorInstance = "error"
+)
+
+// moduleError is the error currently displayed for a module, if err is not
+// nil.
+type moduleError struct {
+	err      error
+	expanded bool
+}
+
+// ShowError displays an error block for the module with the given name.  The
+// block only shows the module name; clicking it toggles the full error.
+func (s *StatusBar) ShowError(name string, err error) {
+	key := BlockKey{Name: name, Instance: errorInstance}
+
+	s.lock.Lock()
+	merr, ok := s.errs[name]
+	if !ok {
+		merr = &moduleError{}
+		s.errs[name] = merr
+	}
+	merr.err = err
+	block := merr.block(name)
+	s.lock.Unlock()
+
+	s.OnClick(key, func(ctx context.Context, evt ClickEvent) {
+		if evt.Button != 1 {
+			return
+		}
+
+		var b Block
+
+		s.lock.Lock()
+		// The module may have been removed since.
+		merr, ok := s.errs[name]
+		ok = ok && merr.err != nil
+		if ok {
+			merr.expanded = !merr.expanded
+			b = merr.block(name)
+		}
+		s.lock.Unlock()
+
+		if ok {
+			s.Update(b)
+		}
+	})
+
+	s.Update(block)
+}
+
+// ClearError removes the error block for the module with the given name, if
+// there is one.
+func (s *StatusBar) ClearError(name string) {
+	s.lock.Lock()
+	merr, ok := s.errs[name]
+	if ok {
+		ok = merr.err != nil
+		merr.err = nil
+	}
+	s.lock.Unlock()
+
+	if ok {
+		s.Remove(BlockKey{Name: name, Instance: errorInstance})
+	}
+}
+
+func (e *moduleError) block(name string) Block {
+	block := Block{
+		Name:      name,
+		Instance:  errorInstance,
+		FullText:  fmt.Sprintf("%s %s", errorIcon, name),
+		ShortText: errorIcon,
+		State:     StateCritical,
+	}
+
+	if e.expanded {
+		block.FullText = fmt.Sprintf("%s %s: %v", errorIcon, name, e.err)
+	}
+
+	return block
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestShowErrorClickAfterRemove(t *testing.T) {
+	sb := NewStatusBar(nil)
+	key := BlockKey{Name: "time", Instance: errorInstance}
+
+	sb.ShowError("time", errors.New("failed"))
+
+	sb.lock.Lock()
+	fn := sb.clickMap[key]
+	sb.lock.Unlock()
+
+	sb.RemoveModule("time")
+
+	// A click already dispatched runs after the module is gone.
+	fn(context.Background(), ClickEvent{Name: key.Name, Instance: key.Instance, Button: 1})
+
+	if hasBlock(sb, key) {
+		t.Error("error block shown after the module was removed")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Icon keys, by the semantic state they show.
+const (
+	iconVolumeMuted  = "volume.muted"
+	iconVolumeLow    = "volume.low"
+	iconVolumeMedium = "volume.medium"
+	iconVolumeHigh   = "volume.high"
+
+	iconBatteryEmpty    = "battery.empty"
+	iconBatteryLow      = "battery.low"
+	iconBatteryHalf     = "battery.half"
+	iconBatteryHigh     = "battery.high"
+	iconBatteryFull     = "battery.full"
+	iconBatteryCharging = "battery.charging"
+
+	iconWifiWeak      = "wifi.weak"
+	iconWifiFair      = "wifi.fair"
+	iconWifiGood      = "wifi.good"
+	iconWifiExcellent = "wifi.excellent"
+	iconEthernet      = "ethernet"
+
+	iconPlayerPlaying = "player.playing"
+	iconPlayerPaused  = "player.paused"
+	iconPlayerStopped = "player.stopped"
+	iconPlayer        = "player"
+)
+
+// Icon buckets, from the lowest percentage to the highest.
+var (
+	volumeIconLevels  = []string{iconVolumeLow, iconVolumeMedium, iconVolumeHigh}
+	batteryIconLevels = []string{iconBatteryEmpty, iconBatteryLow, iconBatteryHalf, iconBatteryHigh, iconBatteryFull}
+	wifiIconLevels    = []string{iconWifiWeak, iconWifiFair, iconWifiGood, iconWifiExcellent}
+)
+
+// IconSet maps icon keys to the text displayed for them.
+type IconSet map[string]string
+
+// iconSets are the built-in icon sets, by name.  Every set has every key.
+var iconSets = map[string]IconSet{
+	"emoji": {
+		iconVolumeMuted:  "🔇",
+		iconVolumeLow:    "🔈",
+		iconVolumeMedium: "🔉",
+		iconVolumeHigh:   "🔊",
+
+		iconBatteryEmpty:    "🔋",
+		iconBatteryLow:      "🔋",
+		iconBatteryHalf:     "🔋",
+		iconBatteryHigh:     "🔋",
+		iconBatteryFull:     "🔋",
+		iconBatteryCharging: "🔌",
+
+		iconWifiWeak:      "📶",
+		iconWifiFair:      "📶",
+		iconWifiGood:      "📶",
+		iconWifiExcellent: "📶",
+		iconEthernet:      "🖧",
+
+		iconPlayerPlaying: "▶️",
+		iconPlayerPaused:  "⏸️",
+		iconPlayerStopped: "⏹️",
+		iconPlayer:        "♪",
+	},
+
+	// Material Design icons from Nerd Fonts 3.
+	"nerdfont": {
+		iconVolumeMuted:  "\U000F075F",
+		iconVolumeLow:    "\U000F057F",
+		iconVolumeMedium: "\U000F0580",
+		iconVolumeHigh:   "\U000F057E",
+
+		iconBatteryEmpty:    "\U000F008E",
+		iconBatteryLow:      "\U000F007B",
+		iconBatteryHalf:     "\U000F007E",
+		iconBatteryHigh:     "\U000F0081",
+		iconBatteryFull:     "\U000F0079",
+		iconBatteryCharging: "\U000F0084",
+
+		iconWifiWeak:      "\U000F091F",
+		iconWifiFair:      "\U000F0922",
+		iconWifiGood:      "\U000F0925",
+		iconWifiExcellent: "\U000F0928",
+		iconEthernet:      "\U000F0200",
+
+		iconPlayerPlaying: "\U000F040A",
+		iconPlayerPaused:  "\U000F03E4",
+		iconPlayerStopped: "\U000F04DB",
+		iconPlayer:        "\U000F075A",
+	},
+
+	"ascii": {
+		iconVolumeMuted:  "MUTE:",
+		iconVolumeLow:    "VOL:",
+		iconVolumeMedium: "VOL:",
+		iconVolumeHigh:   "VOL:",
+
+		iconBatteryEmpty:    "BAT:",
+		iconBatteryLow:      "BAT:",
+		iconBatteryHalf:     "BAT:",
+		iconBatteryHigh:     "BAT:",
+		iconBatteryFull:     "BAT:",
+		iconBatteryCharging: "CHR:",
+
+		iconWifiWeak:      "W:",
+		iconWifiFair:      "W:",
+		iconWifiGood:      "W:",
+		iconWifiExcellent: "W:",
+		iconEthernet:      "E:",
+
+		iconPlayerPlaying: ">",
+		iconPlayerPaused:  "||",
+		iconPlayerStopped: "[]",
+		iconPlayer:        "~",
+	},
+}
+
+// loadIconSet returns the built-in icon set with the given name, with the
+// given icons replaced.
+func loadIconSet(name string, overrides map[string]string) (IconSet, error) {
+	if name == "" {
+		name = "emoji"
+	}
+
+	base, ok := iconSets[name]
+	if !ok {
+		names := make([]string, 0, len(iconSets))
+		for n := range iconSets {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		return nil, fmt.Errorf("unknown icon set %q; expected one of %s", name, strings.Join(names, ", "))
+	}
+
+	icons := make(IconSet, len(base))
+	for key, icon := range base {
+		icons[key] = icon
+	}
+
+	for key, icon := range overrides {
+		if _, ok := icons[key]; !ok {
+			return nil, fmt.Errorf("unknown icon %q", key)
+		}
+		icons[key] = icon
+	}
+
+	return icons, nil
+}
+
+// get returns the icon with the given key.
+func (s IconSet) get(key string) string {
+	return s[key]
+}
+
+// level returns the icon for a percentage, splitting the range evenly between
+// the keys, ordered from lowest to highest.
+func (s IconSet) level(percent float64, keys []string) string {
+	i := int(percent / 100 * float64(len(keys)))
+
+	switch {
+	case i < 0:
+		i = 0
+	case i >= len(keys):
+		i = len(keys) - 1
+	}
+
+	return s.get(keys[i])
+}
@@ -0,0 +1,159 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+const (
+	// DefaultMaxSize is the size a log file grows to before it is rotated.
+	DefaultMaxSize = 1 << 20
+
+	// DefaultBackups is the number of rotated log files kept.
+	DefaultBackups = 3
+)
+
+// FileSink writes records as lines of text to a file, which is rotated when
+// it grows too large: the file is renamed with a .1 suffix, previously
+// rotated files are shifted up, e.g. from .1 to .2, and the oldest is
+// removed.
+type FileSink struct {
+	lock    sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+
+	f    *os.File
+	size int64
+}
+
+// NewFileSink opens the log file at path for appending, creating it and its
+// directory if needed.  A maxSize or backups of zero uses the defaults.
+func NewFileSink(path string, maxSize int64, backups int) (*FileSink, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if backups <= 0 {
+		backups = DefaultBackups
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	s := &FileSink{
+		path:    path,
+		maxSize: maxSize,
+		backups: backups,
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// DefaultPath returns the default location of an application's log file,
+// following the XDG base directory specification.
+func DefaultPath(app string) (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find home directory: %w", err)
+		}
+
+		dir = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(dir, app, app+".log"), nil
+}
+
+func (s *FileSink) Write(r *Record) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.f == nil {
+		return os.ErrClosed
+	}
+
+	line := formatText(r)
+
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := io.WriteString(s.f, line)
+	s.size += int64(n)
+
+	return err
+}
+
+// Close closes the log file.
+func (s *FileSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.f == nil {
+		return nil
+	}
+
+	err := s.f.Close()
+	s.f = nil
+
+	return err
+}
+
+// open opens the log file.  Must be called with the lock held, or before the
+// sink is used.
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	s.f = f
+	s.size = info.Size()
+
+	return nil
+}
+
+// rotate moves the log file aside, and opens a new one.  Must be called with
+// the lock held.
+func (s *FileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	s.f = nil
+
+	for i := s.backups - 1; i > 0; i-- {
+		err := os.Rename(s.backup(i), s.backup(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate log file: %w", err)
+		}
+	}
+
+	if err := os.Rename(s.path, s.backup(1)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+
+	return s.open()
+}
+
+func (s *FileSink) backup(i int) string {
+	return s.path + "." + strconv.Itoa(i)
+}
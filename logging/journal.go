@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// journalSocket is where journald receives entries using its native protocol.
+// See https://systemd.io/JOURNAL_NATIVE_PROTOCOL/ for more info.
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalPriorities maps levels to syslog priorities.
+var journalPriorities = map[Level]string{
+	LevelDebug: "7",
+	LevelInfo:  "6",
+	LevelWarn:  "4",
+	LevelError: "3",
+}
+
+// JournalSink sends records to the systemd journal.  The module is stored in
+// the MODULE field, and record fields as fields with upper case keys.
+type JournalSink struct {
+	conn       *net.UnixConn
+	identifier string
+}
+
+// NewJournalSink connects to the journal, identifying entries with the given
+// syslog identifier.
+func NewJournalSink(identifier string) (*JournalSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journal: %w", err)
+	}
+
+	return &JournalSink{
+		conn:       conn,
+		identifier: identifier,
+	}, nil
+}
+
+func (s *JournalSink) Write(r *Record) error {
+	var b bytes.Buffer
+
+	writeJournalField(&b, "MESSAGE", r.Message)
+	writeJournalField(&b, "PRIORITY", journalPriorities[r.Level])
+	writeJournalField(&b, "SYSLOG_IDENTIFIER", s.identifier)
+
+	if r.Module != "" {
+		writeJournalField(&b, "MODULE", r.Module)
+	}
+
+	for _, f := range r.Fields {
+		writeJournalField(&b, journalKey(f.Key), formatValue(f.Value))
+	}
+
+	// Each datagram is a single entry.
+	if _, err := s.conn.Write(b.Bytes()); err != nil {
+		return fmt.Errorf("failed to write to journal: %w", err)
+	}
+
+	return nil
+}
+
+// Close disconnects from the journal.
+func (s *JournalSink) Close() error {
+	return s.conn.Close()
+}
+
+// writeJournalField writes a field as KEY=value, or, if the value has more
+// than one line, as the key followed by the value's length and the value.
+func writeJournalField(b *bytes.Buffer, key, value string) {
+	b.WriteString(key)
+
+	if !strings.Contains(value, "\n") {
+		b.WriteByte('=')
+		b.WriteString(value)
+		b.WriteByte('\n')
+		return
+	}
+
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// journalKey turns a field's key into a valid journal field name, which has
+// only upper case letters, digits and underscores, and can't start with an
+// underscore or digit.
+func journalKey(key string) string {
+	k := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+
+	if k == "" || k[0] == '_' || (k[0] >= '0' && k[0] <= '9') {
+		k = "F" + k
+	}
+
+	return k
+}
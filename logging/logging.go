@@ -0,0 +1,286 @@
+// Package logging is a leveled, structured logger.  Records are tagged with
+// the module that logged them, and carry key/value fields, e.g.
+//
+//	log := logging.New("battery")
+//	log.Warn("failed to refresh device", "path", path, "err", err)
+//
+// Records below the configured level are dropped, and the rest are written to
+// every configured sink: standard error by default, a rotating file or the
+// systemd journal.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Level is the severity of a record.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses a level's name: "debug", "info", "warn" or "error".
+func ParseLevel(name string) (Level, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(name, n) {
+			return Level(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown log level %q; expected one of %s", name, strings.Join(levelNames, ", "))
+}
+
+// Field is a key/value pair attached to a record.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Record is a single logged message.
+type Record struct {
+	Time    time.Time
+	Level   Level
+	Module  string
+	Message string
+	Fields  []Field
+}
+
+// Sink writes records somewhere.
+type Sink interface {
+	Write(r *Record) error
+}
+
+// badKey is used for a value without a key.
+const badKey = "!BADKEY"
+
+var (
+	lock  sync.RWMutex
+	level = LevelInfo
+	sinks = []Sink{NewTextSink(os.Stderr)}
+)
+
+// SetLevel sets the lowest level that is logged.
+func SetLevel(l Level) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	level = l
+}
+
+// Enabled reports whether records at the given level are logged.
+func Enabled(l Level) bool {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	return l >= level
+}
+
+// SetSinks replaces the sinks records are written to, returning the previous
+// ones, so that they can be closed.
+func SetSinks(s ...Sink) []Sink {
+	lock.Lock()
+	defer lock.Unlock()
+
+	prev := sinks
+	sinks = s
+
+	return prev
+}
+
+// Logger logs records tagged with a module, and fields shared by every record.
+// The zero value logs untagged records.
+type Logger struct {
+	module string
+	fields []Field
+}
+
+var std Logger
+
+// New returns a logger tagging records with the given module.
+func New(module string) *Logger {
+	return &Logger{module: module}
+}
+
+// With returns a logger that adds the given key/value pairs to every record.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]Field, 0, len(l.fields)+len(kv)/2)
+	fields = append(fields, l.fields...)
+
+	return &Logger{
+		module: l.module,
+		fields: appendFields(fields, kv),
+	}
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+func (l *Logger) Info(msg string, kv ...interface{})  { l.log(LevelInfo, msg, kv) }
+func (l *Logger) Warn(msg string, kv ...interface{})  { l.log(LevelWarn, msg, kv) }
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+// Debug, Info, Warn and Error log untagged records.
+func Debug(msg string, kv ...interface{}) { std.log(LevelDebug, msg, kv) }
+func Info(msg string, kv ...interface{})  { std.log(LevelInfo, msg, kv) }
+func Warn(msg string, kv ...interface{})  { std.log(LevelWarn, msg, kv) }
+func Error(msg string, kv ...interface{}) { std.log(LevelError, msg, kv) }
+
+func (l *Logger) log(lvl Level, msg string, kv []interface{}) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if lvl < level {
+		return
+	}
+
+	fields := make([]Field, 0, len(l.fields)+len(kv)/2)
+	fields = append(fields, l.fields...)
+
+	r := &Record{
+		Time:    time.Now(),
+		Level:   lvl,
+		Module:  l.module,
+		Message: msg,
+		Fields:  appendFields(fields, kv),
+	}
+
+	for _, s := range sinks {
+		if err := s.Write(r); err != nil {
+			// There's nowhere else to report it.
+			fmt.Fprintln(os.Stderr, "failed to write log:", err)
+		}
+	}
+}
+
+// appendFields appends alternating keys and values as fields.  A value
+// without a key, or with a key that isn't a string, is given a placeholder
+// key.
+func appendFields(fields []Field, kv []interface{}) []Field {
+	for len(kv) > 0 {
+		key, ok := kv[0].(string)
+		if !ok || len(kv) == 1 {
+			fields = append(fields, Field{Key: badKey, Value: kv[0]})
+			kv = kv[1:]
+			continue
+		}
+
+		fields = append(fields, Field{Key: key, Value: kv[1]})
+		kv = kv[2:]
+	}
+
+	return fields
+}
+
+// Writer returns a writer logging each line written to it as an untagged
+// record at the given level.  It is meant for the standard library's log
+// package.
+func Writer(l Level) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+			std.log(l, line, nil)
+		}
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// textSink writes records as lines of text.
+type textSink struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// NewTextSink returns a sink writing records as lines of text, e.g.
+//
+//	2021/06/04 10:21:09 WARN battery: failed to refresh device err="timeout"
+func NewTextSink(w io.Writer) Sink {
+	return &textSink{w: w}
+}
+
+func (s *textSink) Write(r *Record) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err := io.WriteString(s.w, formatText(r))
+	return err
+}
+
+// formatText formats a record as a line of text.
+func formatText(r *Record) string {
+	var b strings.Builder
+
+	b.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	b.WriteString(strings.ToUpper(r.Level.String()))
+	b.WriteByte(' ')
+
+	if r.Module != "" {
+		b.WriteString(r.Module)
+		b.WriteString(": ")
+	}
+
+	b.WriteString(r.Message)
+
+	for _, f := range r.Fields {
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		b.WriteString(quoteValue(formatValue(f.Value)))
+	}
+
+	b.WriteByte('\n')
+
+	return b.String()
+}
+
+// formatValue formats a field's value as text.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprintf("%+v", v)
+	}
+}
+
+// quoteValue quotes text that would otherwise be ambiguous in a line of
+// key=value pairs.
+func quoteValue(s string) string {
+	if s == "" {
+		return `""`
+	}
+
+	for _, r := range s {
+		if r == '"' || r == '=' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/tom5760/swaybar-status/logging"
+)
+
+const (
+	logOutputStderr  = "stderr"
+	logOutputFile    = "file"
+	logOutputJournal = "journal"
+
+	// logIdentifier identifies the bar's entries in the journal.
+	logIdentifier = "swaybar-status"
+)
+
+// LogConfig configures logging.
+type LogConfig struct {
+	// Level is the lowest level logged: "debug", "info" (default), "warn" or
+	// "error".  Debug logging includes D-Bus signal traffic.
+	Level string `json:"level,omitempty"`
+
+	// Outputs lists where records are written: "stderr" (default), "file"
+	// and "journal", for the systemd journal.
+	Outputs []string `json:"outputs,omitempty"`
+
+	// File is the path of the log file.  Defaults to
+	// $XDG_STATE_HOME/swaybar-status/swaybar-status.log.
+	File string `json:"file,omitempty"`
+
+	// MaxSize is the size in bytes the log file grows to before it is
+	// rotated, and Backups is the number of rotated files kept.
+	MaxSize int64 `json:"max_size,omitempty"`
+	Backups int   `json:"backups,omitempty"`
+}
+
+func (c *LogConfig) validate() error {
+	if c.Level != "" {
+		if _, err := logging.ParseLevel(c.Level); err != nil {
+			return err
+		}
+	}
+
+	for _, output := range c.Outputs {
+		switch output {
+		case logOutputStderr, logOutputFile, logOutputJournal:
+		default:
+			return fmt.Errorf("unknown output %q", output)
+		}
+	}
+
+	if c.MaxSize < 0 {
+		return errors.New("max_size must not be negative")
+	}
+	if c.Backups < 0 {
+		return errors.New("backups must not be negative")
+	}
+
+	return nil
+}
+
+// setupLogging configures the level and outputs of the logger.  The level and
+// outputs given on the command line, if not empty, override the
+// configuration.  Records for the stderr output are written to the given
+// sink.  It returns a function closing the outputs.
+func setupLogging(c LogConfig, level, outputs string, stderr logging.Sink) (func(), error) {
+	if level != "" {
+		c.Level = level
+	}
+	if outputs != "" {
+		c.Outputs = strings.Split(outputs, ",")
+	}
+	if len(c.Outputs) == 0 {
+		c.Outputs = []string{logOutputStderr}
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid logging: %w", err)
+	}
+
+	lvl := logging.LevelInfo
+	if c.Level != "" {
+		lvl, _ = logging.ParseLevel(c.Level)
+	}
+
+	var (
+		sinks   []logging.Sink
+		closers []io.Closer
+	)
+
+	closeAll := func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+
+	for _, output := range c.Outputs {
+		switch output {
+		case logOutputStderr:
+			sinks = append(sinks, stderr)
+
+		case logOutputFile:
+			path := c.File
+			if path == "" {
+				p, err := logging.DefaultPath(logIdentifier)
+				if err != nil {
+					closeAll()
+					return nil, err
+				}
+				path = p
+			}
+
+			sink, err := logging.NewFileSink(path, c.MaxSize, c.Backups)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+			closers = append(closers, sink)
+
+		case logOutputJournal:
+			sink, err := logging.NewJournalSink(logIdentifier)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			sinks = append(sinks, sink)
+			closers = append(closers, sink)
+		}
+	}
+
+	logging.SetLevel(lvl)
+	logging.SetSinks(sinks...)
+
+	return func() {
+		logging.SetSinks(logging.NewTextSink(os.Stderr))
+		closeAll()
+	}, nil
+}
+
+// redirectStdLog sends anything logged with the standard library's log
+// package, e.g. by dependencies, through the logger.
+func redirectStdLog() {
+	log.SetFlags(0)
+	log.SetOutput(logging.Writer(logging.LevelInfo))
+}
@@ -3,35 +3,164 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"golang.org/x/sync/errgroup"
+
+	"github.com/tom5760/swaybar-status/logging"
 )
 
 var (
-	inputReader io.Reader = os.Stdin
-
-	statusFuncs = []func(context.Context, *StatusBar) error{
-		statusBattery,
-		statusNetwork,
-		//statusPlayer,
-		statusTime,
-		statusVolume,
-	}
+	configFlag    = flag.String("config", "", "path to the configuration file")
+	outputFlag    = flag.String("output", "swaybar", "output format: swaybar, i3bar, waybar, lemonbar, text or preview; or json with -once")
+	previewFlag   = flag.Bool("preview", false, "preview the bar in the terminal, clicking blocks with the keyboard; same as -output preview")
+	onlyFlag      = flag.String("only", "", "comma separated names of the only modules to run")
+	recordFlag    = flag.String("record", "", "record the session with swaybar to a file")
+	replayFlag    = flag.String("replay", "", "replay a recorded session, comparing the output")
+	updateFlag    = flag.Bool("update", false, "with -replay, update the recording with the new output")
+	onceFlag      = flag.Bool("once", false, "print a single status line once every module has shown its blocks, then exit")
+	timeoutFlag   = flag.Duration("timeout", onceTimeout, "with -once, how long to wait for modules")
+	logLevelFlag  = flag.String("log-level", "", "lowest level logged: debug, info, warn or error; overrides the config")
+	logOutputFlag = flag.String("log-output", "", "comma separated log outputs: stderr, file or journal; overrides the config")
 )
 
 func main() {
-	if err := run(); err != nil {
-		log.Println(err)
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		if err := ctl(os.Args[2:]); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	flag.Parse()
+
+	// Report writes to a closed stdout as errors instead of being killed by
+	// SIGPIPE, so the bar can shut down cleanly.
+	signal.Ignore(syscall.SIGPIPE)
+
+	redirectStdLog()
+
+	if err := start(); err != nil {
+		logging.Error(err.Error())
 		os.Exit(1)
 	}
 }
 
-func run() error {
-	sb := NewStatusBar(os.Stdout)
+// start loads the configuration and runs the status bar in the mode selected
+// by the command line flags.
+func start() error {
+	cfg, err := loadStartConfig()
+	if err != nil {
+		return err
+	}
+
+	if *previewFlag {
+		*outputFlag = "preview"
+	}
+
+	// The preview is redrawn in place, which logging to the terminal would
+	// break, so it shows the records itself.
+	var preview *previewRenderer
+	stderr := logging.NewTextSink(os.Stderr)
+	if *outputFlag == "preview" {
+		preview = newPreviewRenderer(os.Stdout)
+		stderr = preview
+	}
+
+	closeLogs, err := setupLogging(cfg.Log, *logLevelFlag, *logOutputFlag, stderr)
+	if err != nil {
+		return err
+	}
+	defer closeLogs()
+
+	if (*replayFlag != "" || *recordFlag != "") && *outputFlag != "swaybar" {
+		return errors.New("sessions can only be recorded with swaybar output")
+	}
+
+	switch {
+	case *onceFlag:
+		return runOnce(cfg, os.Stdout, *outputFlag, *timeoutFlag)
+
+	case *replayFlag != "":
+		// The flags take precedence over the configuration in the recording.
+		var override *Config
+		if *configFlag != "" || *onlyFlag != "" {
+			override = cfg
+		}
+		return replaySession(*replayFlag, override, *updateFlag)
+
+	case *recordFlag != "":
+		return recordSession(*recordFlag, cfg, os.Stdin, os.Stdout)
+
+	case preview != nil:
+		return runBar(context.Background(), cfg, preview, os.Stdin, loadStartConfig)
+
+	default:
+		return run(cfg, *outputFlag, os.Stdin, os.Stdout, loadStartConfig)
+	}
+}
+
+// loadStartConfig loads the configuration file given on the command line,
+// keeping only the modules selected by the -only flag.  It is also used to
+// reload the configuration.
+func loadStartConfig() (*Config, error) {
+	cfg, err := loadConfig(*configFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	if *onlyFlag != "" {
+		if err := cfg.only(strings.Split(*onlyFlag, ",")); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// run runs the status bar with the given configuration and output format
+// until the input is closed, or writing the output fails.  If load is not
+// nil, it is used to reload the configuration.
+func run(cfg *Config, format string, in io.Reader, out io.Writer, load configLoader) error {
+	renderer, err := newRenderer(format, out)
+	if err != nil {
+		return err
+	}
+
+	return runBar(context.Background(), cfg, renderer, in, load)
+}
+
+// runBar runs the status bar with the given renderer, until the context is
+// canceled, the input is closed, or rendering fails.  The configuration is
+// reloaded with load on SIGHUP, or when a module asks for it, unless load is
+// nil.
+func runBar(ctx context.Context, cfg *Config, renderer Renderer, in io.Reader, load configLoader) error {
+	theme, err := loadTheme(cfg.Theme)
+	if err != nil {
+		return err
+	}
+
+	statusFuncs, err := cfg.build()
+	if err != nil {
+		return err
+	}
+
+	refresh := refreshSignals(cfg)
+
+	sigChan, stopSignals := notifySignals(refresh, load != nil)
+	defer stopSignals()
+
+	sb := NewStatusBar(renderer)
+	sb.SetTheme(theme)
 
 	if err := sb.Open(); err != nil {
 		return fmt.Errorf("failed to open status bar: %w", err)
@@ -39,43 +168,85 @@ func run() error {
 
 	defer func() {
 		if err := sb.Close(); err != nil {
-			log.Println("failed to close status bar:", err)
+			logging.Error("failed to close status bar", "err", err)
 		}
 	}()
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	group, ctx := errgroup.WithContext(ctx)
 
-	go recv(ctx, cancel, sb)
+	runner := newModuleRunner(ctx, sb, sigChan, refresh, load)
+
+	// Reading blocks until the input is closed, so it can't be part of the
+	// group, which would wait for it on shutdown.
+	inputDone := make(chan error, 1)
+
+	if cr, ok := renderer.(clickReader); ok {
+		go func() {
+			defer cancel()
 
-	for i, statusFunc := range statusFuncs {
-		n := i
-		fn := statusFunc
-		group.Go(func() error {
-			if err := fn(ctx, sb); err != nil {
-				return fmt.Errorf("status function %v failed: %w", n, err)
+			err := cr.ReadClicks(ctx, in, func(evt ClickEvent) {
+				sb.Click(ctx, evt)
+			})
+			if err != nil {
+				logging.Error("failed to read clicks", "err", err)
 			}
+		}()
+	} else if renderer.ClickEvents() {
+		go func() {
+			inputDone <- recv(ctx, sb, in)
+		}()
+	}
 
-			log.Printf("function %v finished", n)
+	group.Go(func() error {
+		select {
+		case <-sb.Failed():
+			err := sb.Err()
+			if errors.Is(err, syscall.EPIPE) || errors.Is(err, os.ErrClosed) {
+				return fmt.Errorf("status bar output closed, shutting down: %w", err)
+			}
+			return err
+
+		case err := <-inputDone:
+			return err
+
+		case <-ctx.Done():
 			return nil
-		})
-	}
+		}
+	})
 
-	if err := group.Wait(); err != nil {
-		return err
-	}
+	// Modules are supervised, so only a broken bar ends the group.
+	runner.apply(cfg, statusFuncs)
 
-	return nil
+	// Reloads change the running modules, so signals are handled once they
+	// have started.
+	runner.handle()
+
+	err = group.Wait()
+
+	// The group's context is canceled once it is done, which stops every
+	// module.
+	runner.wait()
+
+	return err
 }
 
-func recv(ctx context.Context, cancel context.CancelFunc, sb *StatusBar) error {
-	defer cancel()
+// errInputClosed is returned by run when swaybar closes its input, which it
+// does when it exits.
+var errInputClosed = errors.New("input closed, shutting down")
 
-	decoder := json.NewDecoder(inputReader)
+// recv sends the click events read from the input to the bar, until the
+// context is canceled or the input fails.
+func recv(ctx context.Context, sb *StatusBar, in io.Reader) error {
+	eofIn := &eofReader{r: in}
+	decoder := json.NewDecoder(eofIn)
 
 	tok, err := decoder.Token()
+	if err != nil && eofIn.eof {
+		return errInputClosed
+	}
 	if err != nil {
 		return fmt.Errorf("failed to read initial input token: %w", err)
 	}
@@ -87,10 +258,14 @@ func recv(ctx context.Context, cancel context.CancelFunc, sb *StatusBar) error {
 	for ctx.Err() == nil {
 		var evt ClickEvent
 		if err := decoder.Decode(&evt); err != nil {
+			// swaybar never ends the array, the input just stops.
+			if eofIn.eof {
+				return errInputClosed
+			}
 			return fmt.Errorf("failed to decode click event: %w", err)
 		}
 
-		sb.Click(evt)
+		sb.Click(ctx, evt)
 	}
 
 	return nil
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRecvInputClosed(t *testing.T) {
+	inputs := []string{
+		"",
+		"[\n",
+		"[\n" + `{"name":"time","button":1}` + "\n",
+		"[\n" + `{"name":"time","button":1}` + "\n," + `{"name":"time","button":3}` + "\n,",
+	}
+
+	for _, input := range inputs {
+		sb := NewStatusBar(nil)
+
+		err := recv(context.Background(), sb, strings.NewReader(input))
+		if !errors.Is(err, errInputClosed) {
+			t.Errorf("recv(%q) = %v; want %v", input, err, errInputClosed)
+		}
+	}
+}
+
+func TestRecvInvalidInput(t *testing.T) {
+	sb := NewStatusBar(nil)
+
+	err := recv(context.Background(), sb, strings.NewReader("[\n{\"button\":\"left\"}\n"))
+	if err == nil || errors.Is(err, errInputClosed) {
+		t.Errorf("recv() = %v; want a decoding error", err)
+	}
+}
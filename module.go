@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"text/template"
+
+	"github.com/tom5760/swaybar-status/logging"
+	"github.com/tom5760/swaybar-status/pango"
+)
+
+// statusFunc runs a module, updating the status bar until the context is
+// canceled.
+type statusFunc func(ctx context.Context, sb *StatusBar) error
+
+// moduleFactory validates a module's configuration and creates its status
+// function.
+type moduleFactory func(mc *ModuleConfig) (statusFunc, error)
+
+// module holds the configuration shared by every kind of module.
+type module struct {
+	// name is the name of the module's blocks.
+	name string
+
+	// pango enables Pango markup in the module's blocks.
+	pango bool
+
+	// icons is the configured icon set.
+	icons IconSet
+
+	// template and shortTemplate override the module's text, if set.
+	template      *template.Template
+	shortTemplate *template.Template
+
+	// log tags records with the module's name.
+	log *logging.Logger
+}
+
+// moduleType describes a kind of module that can be configured.
+type moduleType struct {
+	new moduleFactory
+
+	// actions are the names of the module's built-in click actions.
+	actions []string
+
+	// data is the zero value of the data the module's templates are
+	// executed with, or nil if the module doesn't support templates.
+	data interface{}
+}
+
+// modules maps the names used in the configuration file to module types.
+var modules = map[string]moduleType{
+	"battery": {new: newBatteryModule, data: batteryData{}},
+	"command": {new: newCommandModule, actions: commandActions},
+	"control": {new: newControlModule},
+	"daemon":  {new: newDaemonModule, actions: daemonActions},
+	"network": {new: newNetworkModule, data: networkData{}},
+	"player":  {new: newPlayerModule, actions: playerActions, data: playerData{}},
+	"time":    {new: newTimeModule, actions: timeActions, data: timeData{}},
+	"volume":  {new: newVolumeModule, actions: volumeActions, data: volumeData{}},
+}
+
+// setText sets the block's full and short text from markup, which is only
+// kept if the module uses Pango markup.  If short is empty, short text is
+// derived from the full text.
+func (m module) setText(block *Block, full, short pango.Markup) {
+	if m.pango {
+		block.Markup = markupPango
+		block.FullText = string(full)
+		block.ShortText = string(short)
+	} else {
+		block.FullText = pango.Plain(full)
+		block.ShortText = pango.Plain(short)
+	}
+}
+
+// format sets the block's text by executing the module's templates with data.
+// Without templates, or if they fail, the given markup is used instead, as
+// with setText.
+func (m module) format(block *Block, data interface{}, full, short pango.Markup) {
+	if m.template != nil {
+		if t, err := m.execute(m.template, data); err != nil {
+			m.log.Warn("failed to execute template", "err", err)
+		} else {
+			// The default short text doesn't match a custom full text.
+			full, short = t, ""
+		}
+	}
+
+	if m.shortTemplate != nil {
+		if t, err := m.execute(m.shortTemplate, data); err != nil {
+			m.log.Warn("failed to execute short template", "err", err)
+		} else {
+			short = t
+		}
+	}
+
+	m.setText(block, full, short)
+}
+
+// execute runs a template, whose output is markup if the module uses Pango
+// markup, or otherwise plain text.
+func (m module) execute(t *template.Template, data interface{}) (pango.Markup, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	if m.pango {
+		return pango.Markup(b.String()), nil
+	}
+	return pango.Text(b.String()), nil
+}
@@ -2,27 +2,74 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"time"
 
 	"github.com/tom5760/swaybar-status/networkmanager"
+	"github.com/tom5760/swaybar-status/pango"
 )
 
-const (
-	networkIconEthernet = "🖧"
-	networkIconWireless = "📶"
-)
+// networkData is the data network templates are executed with, for each
+// connection.
+type networkData struct {
+	// Type is "ethernet", "wireless" or "bridge".
+	Type string
+
+	// State is "activating", "up", "deactivating", "down" or "unknown".
+	State string
+	Icon  string
+
+	// SSID and Strength, a percentage, are only set for wireless
+	// connections.
+	SSID     string
+	Strength int
+}
+
+type networkOptions struct {
+	// Interval is how often to poll NetworkManager for active connections.
+	Interval Duration `json:"interval"`
+
+	// WeakBelow shows wireless connections as a warning when the signal
+	// strength percentage drops below this value.
+	WeakBelow uint8 `json:"weak_below"`
+}
+
+func newNetworkModule(mc *ModuleConfig) (statusFunc, error) {
+	opts := networkOptions{
+		Interval:  Duration(10 * time.Second),
+		WeakBelow: 30,
+	}
 
-func statusNetwork(ctx context.Context, sb *StatusBar) error {
+	if err := mc.decodeOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	if opts.Interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
+
+	m := mc.module()
+
+	return func(ctx context.Context, sb *StatusBar) error {
+		return statusNetwork(ctx, sb, m, opts)
+	}, nil
+}
+
+func statusNetwork(ctx context.Context, sb *StatusBar, m module, opts networkOptions) error {
 	nm, err := networkmanager.New()
 	if err != nil {
 		return fmt.Errorf("failed to create networkmanager: %w", err)
 	}
 
 	uuids := make(map[string]bool)
+	refresh := sb.Refreshes(m.name)
 
 	for ctx.Err() == nil {
+		if err := sb.WaitVisible(ctx); err != nil {
+			return nil
+		}
+
 		conns, err := nm.ActiveConnections()
 		if err != nil {
 			return fmt.Errorf("failed to get active connections: %w", err)
@@ -39,10 +86,14 @@ func statusNetwork(ctx context.Context, sb *StatusBar) error {
 			}
 
 			block := Block{
-				Name:     "30-networking",
+				Name:     m.name,
 				Instance: uuid,
 			}
 
+			if _, ok := uuids[uuid]; !ok {
+				sb.BindActions(block.Key(), nil, nil)
+			}
+
 			uuids[uuid] = true
 
 			typ, err := conn.Type()
@@ -55,8 +106,24 @@ func statusNetwork(ctx context.Context, sb *StatusBar) error {
 				return fmt.Errorf("failed to get connection state: %w", err)
 			}
 
+			switch state {
+			case networkmanager.ActiveConnectionStateActivated:
+				block.State = StateIdle
+			case networkmanager.ActiveConnectionStateDeactivated:
+				block.State = StateWarning
+			default:
+				block.State = StateInfo
+			}
+
+			data := networkData{
+				State: networkStateLabel(state),
+			}
+
 			switch typ {
 			case networkmanager.ActiveConnectionEthernet:
+				data.Type = "ethernet"
+				data.Icon = m.icons.get(iconEthernet)
+
 				var label string
 				switch state {
 				case networkmanager.ActiveConnectionStateActivating:
@@ -68,12 +135,34 @@ func statusNetwork(ctx context.Context, sb *StatusBar) error {
 				case networkmanager.ActiveConnectionStateDeactivated:
 					label = "down"
 				}
-				block.FullText = fmt.Sprintf("%s %s", networkIconEthernet, label)
+				m.format(&block, data,
+					pango.Text(fmt.Sprintf("%s %s", data.Icon, label)),
+					pango.Text(data.Icon),
+				)
 
 			case networkmanager.ActiveConnectionWireless:
-				status, err := getWifiStatus(conn)
+				data.Type = "wireless"
+
+				var status, shortStatus pango.Markup
+
+				ssid, strength, err := getWifiStatus(conn)
 				if err != nil {
-					log.Println("failed to get wifi status:", err)
+					m.log.Warn("failed to get wifi status", "err", err)
+				} else {
+					status = pango.Join(
+						pango.Bold(pango.Text(ssid)),
+						pango.Small(pango.Text(fmt.Sprintf(" (%v%%)", strength))),
+					)
+					shortStatus = pango.Text(fmt.Sprintf("%v%%", strength))
+					block.Percentage = int(strength)
+					data.SSID = ssid
+					data.Strength = int(strength)
+				}
+
+				data.Icon = m.icons.level(float64(data.Strength), wifiIconLevels)
+
+				if err == nil && strength < opts.WeakBelow && block.State == StateIdle {
+					block.State = StateWarning
 				}
 
 				var label string
@@ -88,12 +177,21 @@ func statusNetwork(ctx context.Context, sb *StatusBar) error {
 					label = "down"
 				}
 
-				block.FullText = fmt.Sprintf("%s%s%s", networkIconWireless, status, label)
+				m.format(&block, data, pango.Join(
+					pango.Text(data.Icon),
+					status,
+					pango.Text(label),
+				), pango.Join(
+					pango.Text(data.Icon),
+					shortStatus,
+				))
 
 			case networkmanager.ActiveConnectionBridge:
+				data.Type = "bridge"
+				m.format(&block, data, "", "")
 
 			default:
-				log.Println("unexpected connection type:", typ)
+				m.log.Warn("unexpected connection type", "type", typ)
 				continue
 			}
 
@@ -103,7 +201,7 @@ func statusNetwork(ctx context.Context, sb *StatusBar) error {
 		for uuid, exists := range uuids {
 			if !exists {
 				sb.Remove(BlockKey{
-					Name:     "30-networking",
+					Name:     m.name,
 					Instance: uuid,
 				})
 				delete(uuids, uuid)
@@ -111,7 +209,8 @@ func statusNetwork(ctx context.Context, sb *StatusBar) error {
 		}
 
 		select {
-		case <-time.After(10 * time.Second):
+		case <-time.After(time.Duration(opts.Interval)):
+		case <-refresh:
 		case <-ctx.Done():
 			break
 		}
@@ -120,30 +219,45 @@ func statusNetwork(ctx context.Context, sb *StatusBar) error {
 	return nil
 }
 
-func getWifiStatus(conn *networkmanager.ActiveConnection) (string, error) {
+func networkStateLabel(state networkmanager.ActiveConnectionState) string {
+	switch state {
+	case networkmanager.ActiveConnectionStateActivating:
+		return "activating"
+	case networkmanager.ActiveConnectionStateActivated:
+		return "up"
+	case networkmanager.ActiveConnectionStateDeactivating:
+		return "deactivating"
+	case networkmanager.ActiveConnectionStateDeactivated:
+		return "down"
+	default:
+		return "unknown"
+	}
+}
+
+func getWifiStatus(conn *networkmanager.ActiveConnection) (string, uint8, error) {
 	dev, err := findWifiDev(conn)
 	if err != nil {
-		return "", fmt.Errorf("failed to find wifi device: %w", err)
+		return "", 0, fmt.Errorf("failed to find wifi device: %w", err)
 	}
 
 	wifi := dev.WirelessDevice()
 
 	ap, err := wifi.ActiveAccessPoint()
 	if err != nil {
-		return "", fmt.Errorf("failed to get active access point: %w", err)
+		return "", 0, fmt.Errorf("failed to get active access point: %w", err)
 	}
 
 	ssid, err := ap.SSID()
 	if err != nil {
-		return "", fmt.Errorf("failed to get SSID: %w", err)
+		return "", 0, fmt.Errorf("failed to get SSID: %w", err)
 	}
 
 	strength, err := ap.Strength()
 	if err != nil {
-		return "", fmt.Errorf("failed to get Strength: %w", err)
+		return "", 0, fmt.Errorf("failed to get Strength: %w", err)
 	}
 
-	return fmt.Sprintf("%s (%v%%)", string(ssid), strength), nil
+	return string(ssid), strength, nil
 }
 
 func findWifiDev(conn *networkmanager.ActiveConnection) (*networkmanager.Device, error) {
@@ -2,13 +2,15 @@ package networkmanager
 
 import (
 	"fmt"
-	"log"
 
 	"github.com/godbus/dbus/v5"
 
+	"github.com/tom5760/swaybar-status/logging"
 	"github.com/tom5760/swaybar-status/utils"
 )
 
+var log = logging.New("networkmanager")
+
 type (
 	ActiveConnectionType        string
 	ActiveConnectionState       uint32
@@ -186,7 +188,7 @@ func (c *ActiveConnection) SubscribeStateChanged() (<-chan ActiveConnectionState
 		for sig := range sigChan {
 			var change ActiveConnectionStateChange
 			if err := dbus.Store(sig.Body, &change.State, &change.Reason); err != nil {
-				log.Println("failed to store signal:", err)
+				log.Warn("failed to store signal", "signal", sig.Name, "err", err)
 				continue
 			}
 			stateChan <- change
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tom5760/swaybar-status/logging"
+)
+
+// onceTimeout is how long -once waits for every module to show its blocks.
+const onceTimeout = 5 * time.Second
+
+// runOnce runs every module until each has shown its blocks, or the timeout
+// passes, and then writes the blocks in the given format.  Besides the
+// output formats, the format may be "json" for an object of blocks keyed by
+// their name.  Modules that failed are reported as an error, after the
+// output is written.
+func runOnce(cfg *Config, w io.Writer, format string, timeout time.Duration) error {
+	// Check the format before running any modules.
+	if err := checkSnapshotFormat(format); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(cfg.Modules))
+	for i := range cfg.Modules {
+		names = append(names, cfg.Modules[i].name())
+	}
+
+	snap := newSnapshotRenderer(names)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-snap.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := runBar(ctx, cfg, snap, nil, nil); err != nil {
+		return err
+	}
+
+	blocks, missing := snap.result()
+
+	if err := writeSnapshot(w, format, blocks); err != nil {
+		return err
+	}
+
+	for _, name := range missing {
+		logging.New(name).Warn("module showed no blocks", "timeout", timeout)
+	}
+
+	var failed []string
+	for _, block := range blocks {
+		if block.Instance == errorInstance {
+			failed = append(failed, block.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("modules failed: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+func checkSnapshotFormat(format string) error {
+	switch format {
+	case "swaybar", "i3bar", "json":
+		return nil
+
+	case "preview":
+		return errors.New("preview output can't be used with -once")
+
+	default:
+		_, err := newRenderer(format, ioutil.Discard)
+		return err
+	}
+}
+
+// writeSnapshot writes a single status line in the given format.
+func writeSnapshot(w io.Writer, format string, blocks []Block) error {
+	if blocks == nil {
+		blocks = []Block{}
+	}
+
+	switch format {
+	case "swaybar", "i3bar":
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(blocks)
+
+	case "json":
+		byName := make(map[string][]Block)
+		for _, block := range blocks {
+			byName[block.Name] = append(byName[block.Name], block)
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(byName)
+
+	default:
+		r, err := newRenderer(format, w)
+		if err != nil {
+			return err
+		}
+		return r.Render(blocks)
+	}
+}
+
+// snapshotRenderer keeps the latest blocks, and reports when blocks with every
+// one of the given names have been shown.
+type snapshotRenderer struct {
+	lock   sync.Mutex
+	names  []string
+	blocks []Block
+
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+func newSnapshotRenderer(names []string) *snapshotRenderer {
+	return &snapshotRenderer{
+		names: names,
+		done:  make(chan struct{}),
+	}
+}
+
+func (r *snapshotRenderer) Start() error {
+	return nil
+}
+
+func (r *snapshotRenderer) Render(blocks []Block) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.blocks = append([]Block(nil), blocks...)
+
+	if len(r.missing()) == 0 {
+		r.doneOnce.Do(func() { close(r.done) })
+	}
+
+	return nil
+}
+
+func (r *snapshotRenderer) End() error {
+	return nil
+}
+
+func (r *snapshotRenderer) ClickEvents() bool {
+	return false
+}
+
+// result returns the latest blocks, and the names without any blocks.
+func (r *snapshotRenderer) result() ([]Block, []string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.blocks, r.missing()
+}
+
+// missing returns the names without any blocks.  Must be called with the lock
+// held.
+func (r *snapshotRenderer) missing() []string {
+	shown := make(map[string]bool, len(r.blocks))
+	for _, block := range r.blocks {
+		shown[block.Name] = true
+	}
+
+	var missing []string
+	for _, name := range r.names {
+		if !shown[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+
+	return missing
+}
@@ -0,0 +1,155 @@
+// Package pango builds Pango markup, escaping untrusted text.
+// See https://docs.gtk.org/Pango/pango_markup.html for more info.
+package pango
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Markup is a string of Pango markup.
+type Markup string
+
+var escaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	"'", "&#39;",
+	`"`, "&quot;",
+)
+
+// Escape escapes text so that it is displayed as is.  Invalid UTF-8 and
+// control characters, which Pango rejects, are removed.
+func Escape(s string) string {
+	s = strings.ToValidUTF8(s, "")
+
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+
+	return escaper.Replace(s)
+}
+
+// Text returns markup that displays the given text.
+func Text(s string) Markup {
+	return Markup(Escape(s))
+}
+
+// Join concatenates markup.
+func Join(parts ...Markup) Markup {
+	var b strings.Builder
+	for _, part := range parts {
+		b.WriteString(string(part))
+	}
+	return Markup(b.String())
+}
+
+// Attrs are span attributes.  Empty fields are omitted.
+type Attrs struct {
+	// Font is a font description, e.g. "Sans Italic 12".
+	Font string
+
+	// Color is the foreground color, e.g. "#FF0000" or "red".
+	Color string
+
+	// Background is the background color.
+	Background string
+
+	// Weight is a numeric weight or a name, e.g. "bold".
+	Weight string
+
+	// Style is "normal", "oblique" or "italic".
+	Style string
+
+	// Size is a size in 1024ths of a point, or a name, e.g. "small".
+	Size string
+
+	// Rise is the vertical displacement from the baseline, in 1024ths of a
+	// point.
+	Rise int
+
+	// Underline is "none", "single", "double", "low" or "error".
+	Underline string
+}
+
+// Span wraps markup in a span with the given attributes.
+func Span(attrs Attrs, content ...Markup) Markup {
+	var b strings.Builder
+
+	b.WriteString("<span")
+
+	attr := func(name, value string) {
+		if value == "" {
+			return
+		}
+		b.WriteString(" ")
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(Escape(value))
+		b.WriteString(`"`)
+	}
+
+	attr("font", attrs.Font)
+	attr("foreground", attrs.Color)
+	attr("background", attrs.Background)
+	attr("weight", attrs.Weight)
+	attr("style", attrs.Style)
+	attr("size", attrs.Size)
+	if attrs.Rise != 0 {
+		attr("rise", strconv.Itoa(attrs.Rise))
+	}
+	attr("underline", attrs.Underline)
+
+	b.WriteString(">")
+	b.WriteString(string(Join(content...)))
+	b.WriteString("</span>")
+
+	return Markup(b.String())
+}
+
+// Bold displays markup in bold.
+func Bold(content ...Markup) Markup {
+	return Span(Attrs{Weight: "bold"}, content...)
+}
+
+// Small displays markup in a smaller font.
+func Small(content ...Markup) Markup {
+	return Span(Attrs{Size: "small"}, content...)
+}
+
+var unescaper = strings.NewReplacer(
+	"&amp;", "&",
+	"&lt;", "<",
+	"&gt;", ">",
+	"&#39;", "'",
+	"&quot;", `"`,
+)
+
+// Plain returns the text of markup built by this package, without any
+// formatting.
+func Plain(m Markup) string {
+	var b strings.Builder
+
+	s := string(m)
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i == -1 {
+			b.WriteString(s)
+			break
+		}
+
+		b.WriteString(s[:i])
+
+		j := strings.IndexByte(s[i:], '>')
+		if j == -1 {
+			break
+		}
+
+		s = s[i+j+1:]
+	}
+
+	return unescaper.Replace(b.String())
+}
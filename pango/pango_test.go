@@ -0,0 +1,87 @@
+package pango
+
+import "testing"
+
+// hostileTitle is track metadata trying to inject markup.
+const hostileTitle = `</span><span foreground="red">pwned`
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "Hello, World", "Hello, World"},
+		{"ampersand", "Rock & Roll", "Rock &amp; Roll"},
+		{"entity", "&amp;", "&amp;amp;"},
+		{"angle brackets", "<b>bold</b>", "&lt;b&gt;bold&lt;/b&gt;"},
+		{"quotes", `it's "quoted"`, "it&#39;s &quot;quoted&quot;"},
+		{"control characters", "a\x00b\x07c\x1bd", "abcd"},
+		{"whitespace kept", "a\tb\nc\rd", "a\tb\nc\rd"},
+		{"invalid utf-8", "caf\xc3 \xff\xfeok", "caf ok"},
+		{"unicode", "Sigur Rós – Ágætis byrjun ♪", "Sigur Rós – Ágætis byrjun ♪"},
+		{"markup injection", hostileTitle, "&lt;/span&gt;&lt;span foreground=&quot;red&quot;&gt;pwned"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Escape(test.in); got != test.want {
+				t.Errorf("Escape(%q) = %q; want %q", test.in, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSpanEscapesAttributes(t *testing.T) {
+	got := Span(Attrs{
+		Color: `red" weight="bold`,
+		Font:  "Sans <Bold> & 'Italic'",
+		Rise:  -2048,
+	}, Text(hostileTitle))
+
+	want := Markup(`<span font="Sans &lt;Bold&gt; &amp; &#39;Italic&#39;" foreground="red&quot; weight=&quot;bold" rise="-2048">` +
+		`&lt;/span&gt;&lt;span foreground=&quot;red&quot;&gt;pwned</span>`)
+
+	if got != want {
+		t.Errorf("Span() =\n  %s\nwant\n  %s", got, want)
+	}
+}
+
+func TestSpanOmitsEmptyAttributes(t *testing.T) {
+	if got, want := Span(Attrs{}, Text("x")), Markup("<span>x</span>"); got != want {
+		t.Errorf("Span() = %q; want %q", got, want)
+	}
+}
+
+func TestPlainRoundTrip(t *testing.T) {
+	texts := []string{
+		"",
+		"Hello",
+		"Rock & Roll",
+		"&amp; &lt; literally",
+		`it's "quoted"`,
+		"1 < 2 > 0",
+		hostileTitle,
+	}
+
+	for _, text := range texts {
+		markups := []Markup{
+			Text(text),
+			Bold(Text(text)),
+			Join(Small(Text(text)), Span(Attrs{Color: `"><b>`}, Text(""))),
+			Span(Attrs{Color: "#FF0000", Font: `Sans "<i>"`}, Bold(Text(text))),
+		}
+
+		for _, m := range markups {
+			if got := Plain(m); got != text {
+				t.Errorf("Plain(%q) = %q; want %q", m, got, text)
+			}
+		}
+	}
+}
+
+func TestPlainDropsControlCharacters(t *testing.T) {
+	if got, want := Plain(Text("a\x00b\xffc")), "abc"; got != want {
+		t.Errorf("Plain() = %q; want %q", got, want)
+	}
+}
@@ -2,24 +2,31 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 
 	"github.com/godbus/dbus/v5"
 
 	"github.com/tom5760/swaybar-status/mpris"
+	"github.com/tom5760/swaybar-status/pango"
 	"github.com/tom5760/swaybar-status/utils"
 )
 
-const (
-	playerIcon = "♪"
+// playerData is the data player templates are executed with.
+type playerData struct {
+	// Player is the name of the player's D-Bus service.
+	Player string
 
-	playerStatusPlaying = "▶️"
-	playerStatusPaused  = "⏸️"
-	playerStatusStopped = "⏹️"
-)
+	// Status is "Playing", "Paused" or "Stopped".
+	Status string
+	Icon   string
+
+	Title  string
+	Artist string
+	Album  string
+}
 
-func playerBlock(player *mpris.Player) (Block, error) {
+func playerBlock(m module, opts playerOptions, player *mpris.Player) (Block, error) {
 	status, err := player.PlaybackStatus()
 	if err != nil {
 		return Block{}, fmt.Errorf("failed to get player '%s' playback status: %w", player.Name, err)
@@ -40,9 +47,12 @@ func playerBlock(player *mpris.Player) (Block, error) {
 		return Block{}, fmt.Errorf("failed to get player '%s' artist: %w", player.Name, err)
 	}
 
+	// Not every player sets the album.
+	album, _ := metadata.Album()
+
 	var artist string
 	if len(artists) > 0 {
-		artist = " - " + artists[0]
+		artist = " - " + ellipsize(artists[0], opts.ArtistWidth)
 	}
 
 	if title == "" || artist == "" {
@@ -52,23 +62,91 @@ func playerBlock(player *mpris.Player) (Block, error) {
 	var icon string
 	switch status {
 	case mpris.PlaybackStatusPlaying:
-		icon = playerStatusPlaying
+		icon = m.icons.get(iconPlayerPlaying)
 	case mpris.PlaybackStatusPaused:
-		icon = playerStatusPaused
+		icon = m.icons.get(iconPlayerPaused)
 	case mpris.PlaybackStatusStopped:
-		icon = playerStatusStopped
+		icon = m.icons.get(iconPlayerStopped)
 	default:
-		icon = playerIcon
+		icon = m.icons.get(iconPlayer)
+	}
+
+	state := StateIdle
+	if status == mpris.PlaybackStatusPlaying {
+		state = StateInfo
 	}
 
-	return Block{
-		Name:     "40-player",
+	block := Block{
+		Name:     m.name,
 		Instance: player.Name,
-		FullText: fmt.Sprintf("%v %v%v", icon, title, artist),
+		State:    state,
+	}
+
+	data := playerData{
+		Player: player.Name,
+		Status: string(status),
+		Icon:   icon,
+		Title:  title,
+		Artist: artists[0],
+		Album:  album,
+	}
+
+	m.format(&block, data, pango.Join(
+		pango.Text(icon+" "),
+		pango.Bold(pango.Text(ellipsize(title, opts.TitleWidth))),
+		pango.Text(artist),
+	), pango.Join(
+		pango.Text(icon+" "),
+		pango.Text(ellipsize(title, opts.ShortTitleWidth)),
+	))
+
+	return block, nil
+}
+
+var (
+	playerActions = []string{"play-pause", "next", "previous"}
+
+	playerBindings = []ClickBinding{
+		{Button: 1, Action: "play-pause"},
+		{Button: 3, Action: "next"},
+		{Button: 3, Modifiers: []string{ModShift}, Action: "previous"},
+	}
+)
+
+type playerOptions struct {
+	// TitleWidth and ArtistWidth limit the display width of the title and
+	// artist in the full text.
+	TitleWidth  int `json:"title_width"`
+	ArtistWidth int `json:"artist_width"`
+
+	// ShortTitleWidth limits the display width of the title in the short
+	// text.
+	ShortTitleWidth int `json:"short_title_width"`
+}
+
+func newPlayerModule(mc *ModuleConfig) (statusFunc, error) {
+	opts := playerOptions{
+		TitleWidth:      40,
+		ArtistWidth:     30,
+		ShortTitleWidth: 15,
+	}
+
+	if err := mc.decodeOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	if opts.TitleWidth <= 0 || opts.ArtistWidth <= 0 || opts.ShortTitleWidth <= 0 {
+		return nil, errors.New("widths must be positive")
+	}
+
+	m := mc.module()
+
+	return func(ctx context.Context, sb *StatusBar) error {
+		return statusPlayer(ctx, sb, m, opts)
 	}, nil
 }
 
-func statusPlayer(ctx context.Context, sb *StatusBar) error {
+func statusPlayer(ctx context.Context, sb *StatusBar, m module, opts playerOptions) error {
 	sessionBus, err := dbus.SessionBus()
 	if err != nil {
 		return fmt.Errorf("failed to connect to session bus: %w", err)
@@ -91,7 +169,22 @@ func statusPlayer(ctx context.Context, sb *StatusBar) error {
 	}
 	defer propertyChangeUnsub()
 
+	refresh := sb.Refreshes(m.name)
+
 	for ctx.Err() == nil {
+		// Changes are ignored while the bar is hidden; it is refreshed once
+		// the bar is shown again.
+		if !sb.Visible() {
+			select {
+			case <-playersChangeChan:
+			case <-propertyChangeChan:
+			case <-refresh:
+			case <-ctx.Done():
+				return nil
+			}
+			continue
+		}
+
 		players, err = mpris.Players(sessionBus)
 		if err != nil {
 			return fmt.Errorf("failed to list players: %w", err)
@@ -101,10 +194,12 @@ func statusPlayer(ctx context.Context, sb *StatusBar) error {
 			instances[i] = false
 		}
 
+		var blockErr error
+
 		for _, player := range players {
-			block, err := playerBlock(player)
+			block, err := playerBlock(m, opts, player)
 			if err != nil {
-				log.Println("failed to make player block:", err)
+				blockErr = err
 				continue
 			}
 
@@ -117,37 +212,52 @@ func statusPlayer(ctx context.Context, sb *StatusBar) error {
 			sb.Update(block)
 
 			p := player
-			sb.OnClick(block.Key(), func(evt ClickEvent) {
-				switch evt.Button {
-				case 1:
+			sb.BindActions(block.Key(), map[string]ClickFunc{
+				"play-pause": func(ctx context.Context, evt ClickEvent) {
 					if err := p.PlayPause(); err != nil {
-						log.Printf("failed to play/pause player '%v': %v", p.Name, err)
+						m.log.Warn("failed to play/pause player", "player", p.Name, "err", err)
 					}
+				},
 
-				case 3:
+				"next": func(ctx context.Context, evt ClickEvent) {
 					if err := p.Next(); err != nil {
-						log.Printf("failed to next player '%v': %v", p.Name, err)
+						m.log.Warn("failed to skip to next track", "player", p.Name, "err", err)
+					}
+				},
+
+				"previous": func(ctx context.Context, evt ClickEvent) {
+					if err := p.Previous(); err != nil {
+						m.log.Warn("failed to skip to previous track", "player", p.Name, "err", err)
 					}
-				}
-			})
+				},
+			}, playerBindings)
+
+		}
+
+		if blockErr != nil {
+			sb.ShowError(m.name, blockErr)
+		} else {
+			sb.ClearError(m.name)
 		}
 
-		for name, exists := range instances {
+		for instance, exists := range instances {
 			if !exists {
 				sb.Remove(BlockKey{
-					Name:     "40-player",
-					Instance: name,
+					Name:     m.name,
+					Instance: instance,
 				})
-				delete(instances, name)
+				delete(instances, instance)
 			}
 		}
 
 		select {
 		case change := <-playersChangeChan:
-			log.Printf("PLAYER CHANGED: %#v", change)
+			m.log.Debug("player changed", "name", change.Name, "old_owner", change.OldOwner, "new_owner", change.NewOwner)
 
 		case change := <-propertyChangeChan:
-			log.Printf("PROPERTY CHANGED: %#v", change)
+			m.log.Debug("player properties changed", "path", change.Signal.Path, "interface", change.InterfaceName, "changed", change.ChangedProperties)
+
+		case <-refresh:
 
 		case <-ctx.Done():
 			return nil
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/tom5760/swaybar-status/logging"
+)
+
+// ANSI escape sequences used by the preview.
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiDim       = "\x1b[2m"
+	ansiUnderline = "\x1b[4m"
+	ansiReverse   = "\x1b[7m"
+
+	// ansiClear returns to the start of the line and clears the screen
+	// below.
+	ansiClear = "\r\x1b[J"
+
+	// ansiUp moves the cursor up a line.
+	ansiUp = "\x1b[1A"
+
+	previewSeparator = " │ "
+	previewHelp      = "←/→ select · 1-5 click · s shift · c ctrl · q quit"
+
+	// previewMaxLogs is how many records are kept while previewing, to be
+	// written once the preview ends.
+	previewMaxLogs = 100
+
+	// previewMaxLogWidth limits the record shown in the status line.
+	previewMaxLogWidth = 80
+)
+
+// previewRenderer draws the bar in a terminal, redrawing it in place on each
+// update, followed by a line describing the selected block.  Keys pressed in
+// the terminal select blocks and click them.
+//
+// It is also a log sink: writing records to the terminal would break the
+// redraw, so the last one is shown in the status line instead, and they are
+// all written to stderr when the preview ends.
+type previewRenderer struct {
+	lock sync.Mutex
+	w    io.Writer
+
+	blocks   []Block
+	selected BlockKey
+
+	// modifiers are held for the next click.
+	modifiers []string
+
+	// status reports the last click.
+	status string
+
+	// logs are the records logged while previewing, and stderr receives
+	// them, and any later ones, once the preview has ended.
+	logs   []logging.Record
+	stderr logging.Sink
+	ended  bool
+}
+
+func newPreviewRenderer(w io.Writer) *previewRenderer {
+	return &previewRenderer{
+		w:      w,
+		stderr: logging.NewTextSink(os.Stderr),
+	}
+}
+
+func (r *previewRenderer) Start() error {
+	return nil
+}
+
+func (r *previewRenderer) Render(blocks []Block) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.blocks = blocks
+
+	return r.draw()
+}
+
+// End leaves the last bar on the terminal, without the status line, followed
+// by the records logged while previewing.
+func (r *previewRenderer) End() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.ended = true
+
+	line, _ := r.bar(false)
+
+	if _, err := io.WriteString(r.w, ansiClear+line+"\n"); err != nil {
+		return fmt.Errorf("failed to write preview: %w", err)
+	}
+
+	for i := range r.logs {
+		if err := r.stderr.Write(&r.logs[i]); err != nil {
+			return err
+		}
+	}
+	r.logs = nil
+
+	return nil
+}
+
+// Write keeps a record until the preview ends, showing it in the status line.
+func (r *previewRenderer) Write(rec *logging.Record) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.ended {
+		return r.stderr.Write(rec)
+	}
+
+	if len(r.logs) == previewMaxLogs {
+		r.logs = append(r.logs[:0], r.logs[1:]...)
+	}
+	r.logs = append(r.logs, *rec)
+
+	return r.draw()
+}
+
+// ClickEvents is false, as clicks come from the keyboard rather than the
+// swaybar protocol.
+func (r *previewRenderer) ClickEvents() bool {
+	return false
+}
+
+// draw redraws the bar.  Must be called with the lock held.
+func (r *previewRenderer) draw() error {
+	line, sel := r.bar(true)
+
+	var parts []string
+	if sel != nil {
+		selected := sel.Name
+		if sel.Instance != "" {
+			selected += "/" + sel.Instance
+		}
+		for _, mod := range r.modifiers {
+			selected += " +" + mod
+		}
+		parts = append(parts, selected)
+
+		if r.status != "" {
+			parts = append(parts, r.status)
+		}
+	}
+
+	// The help comes last, as it is the first thing cut on a narrow
+	// terminal.
+	if n := len(r.logs); n > 0 {
+		parts = append(parts, previewLogLine(&r.logs[n-1]))
+	}
+	status := strings.Join(append(parts, previewHelp), " · ")
+
+	// Moving back up to redraw in place only works if neither line wraps.
+	if width := r.width(); width > 0 {
+		line = ansiTruncate(line, width)
+		status = ansiTruncate(status, width)
+	}
+
+	out := ansiClear + line + "\n" + ansiDim + status + ansiReset + ansiUp + "\r"
+
+	if _, err := io.WriteString(r.w, out); err != nil {
+		return fmt.Errorf("failed to write preview: %w", err)
+	}
+
+	return nil
+}
+
+// width returns the width of the terminal the preview is drawn in, or 0 if
+// it isn't known.
+func (r *previewRenderer) width() int {
+	f, ok := r.w.(*os.File)
+	if !ok {
+		return 0
+	}
+
+	width, err := termWidth(f.Fd())
+	if err != nil {
+		return 0
+	}
+
+	return width
+}
+
+// bar returns the line of blocks, and the selected block.  Must be called
+// with the lock held.
+func (r *previewRenderer) bar(highlight bool) (string, *Block) {
+	var (
+		b   strings.Builder
+		sel *Block
+	)
+
+	index := r.selectedIndex()
+
+	for i := range r.blocks {
+		block := &r.blocks[i]
+
+		if i > 0 {
+			prev := r.blocks[i-1]
+			if prev.Separator == nil || *prev.Separator {
+				b.WriteString(ansiDim + previewSeparator + ansiReset)
+			} else {
+				b.WriteByte(' ')
+			}
+		}
+
+		b.WriteString(ansiStyle(block.Color, true))
+		b.WriteString(ansiStyle(block.Background, false))
+
+		if block.Urgent {
+			b.WriteString(ansiBold + ansiReverse)
+		}
+
+		if highlight && i == index {
+			b.WriteString(ansiUnderline)
+			sel = block
+		}
+
+		b.WriteString(strings.ReplaceAll(plainText(*block), "\n", " "))
+		b.WriteString(ansiReset)
+	}
+
+	return b.String(), sel
+}
+
+// selectedIndex returns the index of the selected block, or of the first
+// block if it is gone.  Must be called with the lock held.
+func (r *previewRenderer) selectedIndex() int {
+	for i, block := range r.blocks {
+		if block.Key() == r.selected {
+			return i
+		}
+	}
+
+	if len(r.blocks) > 0 {
+		r.selected = r.blocks[0].Key()
+		return 0
+	}
+
+	return -1
+}
+
+// move selects the block delta blocks away from the selected block.
+func (r *previewRenderer) move(delta int) {
+	r.lock.Lock()
+
+	if len(r.blocks) == 0 {
+		r.lock.Unlock()
+		return
+	}
+
+	i := (r.selectedIndex() + delta + len(r.blocks)) % len(r.blocks)
+	r.selected = r.blocks[i].Key()
+
+	err := r.draw()
+	r.lock.Unlock()
+
+	// Logging takes the lock, as the renderer is a log sink.
+	if err != nil {
+		logging.Warn("failed to draw preview", "err", err)
+	}
+}
+
+// toggleModifier holds or releases a modifier for the next click.
+func (r *previewRenderer) toggleModifier(mod string) {
+	r.lock.Lock()
+
+	mods := r.modifiers[:0]
+	found := false
+	for _, m := range r.modifiers {
+		if m == mod {
+			found = true
+			continue
+		}
+		mods = append(mods, m)
+	}
+	if !found {
+		mods = append(mods, mod)
+	}
+	r.modifiers = mods
+
+	err := r.draw()
+	r.lock.Unlock()
+
+	if err != nil {
+		logging.Warn("failed to draw preview", "err", err)
+	}
+}
+
+// click returns a click event for the selected block, as if it was clicked in
+// the middle, with the held modifiers, which are then released.
+func (r *previewRenderer) click(button int) (ClickEvent, bool) {
+	r.lock.Lock()
+
+	index := r.selectedIndex()
+	if index < 0 {
+		r.lock.Unlock()
+		return ClickEvent{}, false
+	}
+
+	x := 0
+	for i := 0; i < index; i++ {
+		x += textWidth(plainText(r.blocks[i])) + textWidth(previewSeparator)
+	}
+
+	block := r.blocks[index]
+	width := textWidth(plainText(block))
+
+	evt := ClickEvent{
+		Name:      block.Name,
+		Instance:  block.Instance,
+		Button:    button,
+		Modifiers: r.modifiers,
+		X:         x + width/2,
+		RelativeX: width / 2,
+		Width:     width,
+		Height:    1,
+		Scale:     1,
+	}
+
+	r.modifiers = nil
+	r.status = fmt.Sprintf("clicked button %d", button)
+	if len(evt.Modifiers) > 0 {
+		r.status += " with " + strings.Join(evt.Modifiers, "+")
+	}
+
+	err := r.draw()
+	r.lock.Unlock()
+
+	if err != nil {
+		logging.Warn("failed to draw preview", "err", err)
+	}
+
+	return evt, true
+}
+
+// previewLogLine formats a record for the status line, on a single line.
+func previewLogLine(rec *logging.Record) string {
+	var b strings.Builder
+
+	b.WriteString(strings.ToUpper(rec.Level.String()))
+	b.WriteByte(' ')
+
+	if rec.Module != "" {
+		b.WriteString(rec.Module)
+		b.WriteString(": ")
+	}
+
+	b.WriteString(rec.Message)
+
+	for _, f := range rec.Fields {
+		fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+	}
+
+	line := []rune(strings.Join(strings.Fields(b.String()), " "))
+	if len(line) > previewMaxLogWidth {
+		line = append(line[:previewMaxLogWidth-1], '…')
+	}
+
+	return string(line)
+}
+
+// ReadClicks reads keys from the terminal until q is pressed, or the context
+// is canceled, turning them into click events on the selected block.
+func (r *previewRenderer) ReadClicks(ctx context.Context, in io.Reader, click func(ClickEvent)) error {
+	// Without a terminal, the preview is shown until the bar is stopped.
+	f, ok := in.(*os.File)
+	if !ok {
+		logging.Warn("keyboard input disabled: input isn't a terminal")
+		<-ctx.Done()
+		return nil
+	}
+
+	restore, err := makeRaw(f.Fd())
+	if err != nil {
+		logging.Warn("keyboard input disabled", "err", err)
+		<-ctx.Done()
+		return nil
+	}
+	defer restore()
+
+	keys := make(chan []byte)
+	readErr := make(chan error, 1)
+
+	go func() {
+		for {
+			buf := make([]byte, 16)
+			n, err := in.Read(buf)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			keys <- buf[:n]
+		}
+	}()
+
+	for {
+		var buf []byte
+
+		select {
+		case buf = <-keys:
+		case err := <-readErr:
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read keyboard input: %w", err)
+		case <-ctx.Done():
+			return nil
+		}
+
+		for len(buf) > 0 {
+			key := buf[0]
+			buf = buf[1:]
+
+			switch key {
+			case 'q', 0x03, 0x04: // Ctrl-C and Ctrl-D quit too.
+				return nil
+
+			case 0x1b:
+				// Arrow keys are sent as ESC [ C or ESC [ D.
+				if len(buf) >= 2 && buf[0] == '[' {
+					switch buf[1] {
+					case 'C':
+						r.move(1)
+					case 'D':
+						r.move(-1)
+					}
+					buf = buf[2:]
+				}
+
+			case 'l', '\t':
+				r.move(1)
+
+			case 'h':
+				r.move(-1)
+
+			case 's':
+				r.toggleModifier(ModShift)
+
+			case 'c':
+				r.toggleModifier(ModControl)
+
+			case '1', '2', '3', '4', '5', '\r', ' ':
+				button := 1
+				if key >= '1' && key <= '5' {
+					button, _ = strconv.Atoi(string(key))
+				}
+
+				if evt, ok := r.click(button); ok {
+					click(evt)
+				}
+			}
+		}
+	}
+}
+
+// ansiTruncate shortens a line with escape sequences to at most the given
+// display width, ending it with an ellipsis if anything was cut.  Escape
+// sequences take no space, and the style is reset after a cut.
+func ansiTruncate(s string, width int) string {
+	if textWidth(ansiStrip(s)) <= width {
+		return s
+	}
+
+	limit := width - textWidth(ellipsis)
+
+	var b strings.Builder
+	w := 0
+
+	for i := 0; i < len(s); {
+		if n := ansiEscapeLen(s[i:]); n > 0 {
+			b.WriteString(s[i : i+n])
+			i += n
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if w+runeWidth(r) > limit {
+			break
+		}
+
+		b.WriteRune(r)
+		w += runeWidth(r)
+		i += size
+	}
+
+	return b.String() + ellipsis + ansiReset
+}
+
+// ansiStrip removes escape sequences from a line.
+func ansiStrip(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); {
+		if n := ansiEscapeLen(s[i:]); n > 0 {
+			i += n
+			continue
+		}
+
+		b.WriteByte(s[i])
+		i++
+	}
+
+	return b.String()
+}
+
+// ansiEscapeLen returns the length of the control sequence, ESC [ ...
+// followed by a final byte, at the start of s, or 0 if there is none.
+func ansiEscapeLen(s string) int {
+	if !strings.HasPrefix(s, "\x1b[") {
+		return 0
+	}
+
+	for i := 2; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7E {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// ansiStyle returns the escape sequence for a swaybar color, #RRGGBB or
+// #RRGGBBAA, as a true color foreground or background.  Invalid colors are
+// ignored.
+func ansiStyle(color string, foreground bool) string {
+	color = strings.TrimPrefix(color, "#")
+	if len(color) != 6 && len(color) != 8 {
+		return ""
+	}
+
+	v, err := strconv.ParseUint(color[:6], 16, 32)
+	if err != nil {
+		return ""
+	}
+
+	code := 48
+	if foreground {
+		code = 38
+	}
+
+	return fmt.Sprintf("\x1b[%d;2;%d;%d;%dm", code, v>>16, v>>8&0xFF, v&0xFF)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tom5760/swaybar-status/logging"
+)
+
+func TestPreviewShowsLogs(t *testing.T) {
+	var out, stderr bytes.Buffer
+
+	r := newPreviewRenderer(&out)
+	r.stderr = logging.NewTextSink(&stderr)
+
+	prev := logging.SetSinks(r)
+	defer logging.SetSinks(prev...)
+
+	if err := r.Render([]Block{{Name: "time", FullText: "12:00"}}); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	logging.New("battery").Warn("failed to refresh\ndevice", "err", "timeout")
+
+	if stderr.Len() > 0 {
+		t.Errorf("logged to stderr while previewing: %q", stderr.String())
+	}
+
+	if want := "WARN battery: failed to refresh device err=timeout"; !strings.Contains(out.String(), want) {
+		t.Errorf("status line doesn't show %q: %q", want, out.String())
+	}
+
+	if err := r.End(); err != nil {
+		t.Fatalf("End: %v", err)
+	}
+
+	if !strings.Contains(stderr.String(), "WARN battery: failed to refresh") {
+		t.Errorf("record not written to stderr after the preview ended: %q", stderr.String())
+	}
+
+	stderr.Reset()
+	logging.Warn("after")
+
+	if !strings.Contains(stderr.String(), "WARN after") {
+		t.Errorf("record not written to stderr after the preview ended: %q", stderr.String())
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken terminal")
+}
+
+func TestPreviewLogsDrawErrors(t *testing.T) {
+	r := newPreviewRenderer(failingWriter{})
+	r.stderr = logging.NewTextSink(&bytes.Buffer{})
+	r.blocks = []Block{{Name: "a"}, {Name: "b"}}
+
+	prev := logging.SetSinks(r)
+	defer logging.SetSinks(prev...)
+
+	// Draw errors are logged, which must not wait for the renderer's lock.
+	r.move(1)
+	r.toggleModifier(ModShift)
+	r.click(1)
+
+	if len(r.logs) != 3 {
+		t.Errorf("got %d records; want 3", len(r.logs))
+	}
+}
+
+func TestPreviewLogLineTruncated(t *testing.T) {
+	rec := logging.Record{Level: logging.LevelError, Message: strings.Repeat("x", 200)}
+
+	line := []rune(previewLogLine(&rec))
+	if len(line) != previewMaxLogWidth || line[len(line)-1] != '…' {
+		t.Errorf("previewLogLine() = %q; want %d characters ending in …", string(line), previewMaxLogWidth)
+	}
+}
+
+func TestANSITruncate(t *testing.T) {
+	red := ansiStyle("#FF0000", true)
+
+	tests := []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{red + "exact" + ansiReset, 5, red + "exact" + ansiReset},
+		{red + "too long" + ansiReset, 5, red + "too …" + ansiReset},
+		{"ab" + red + "cdef" + ansiReset, 4, "ab" + red + "c…" + ansiReset},
+		{"日本語", 4, "日…" + ansiReset},
+	}
+
+	for _, test := range tests {
+		if got := ansiTruncate(test.in, test.width); got != test.want {
+			t.Errorf("ansiTruncate(%q, %d) = %q; want %q", test.in, test.width, got, test.want)
+		}
+	}
+}
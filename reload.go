@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/tom5760/swaybar-status/logging"
+)
+
+// reloadSignal makes the status bar reload its configuration.
+const reloadSignal = syscall.SIGHUP
+
+// configLoader loads the configuration again, for a reload.
+type configLoader func() (*Config, error)
+
+// OnReload sets the function that reloads the configuration.
+func (s *StatusBar) OnReload(fn func() error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.reload = fn
+}
+
+// Reload reloads the configuration.  An invalid configuration is reported,
+// and the current one is kept.  Modules are restarted in the background,
+// after Reload returns.
+func (s *StatusBar) Reload() error {
+	s.lock.Lock()
+	fn := s.reload
+	s.lock.Unlock()
+
+	if fn == nil {
+		return errors.New("reloading isn't supported")
+	}
+
+	return fn()
+}
+
+// moduleRunner runs the configured modules, each with its own context, and
+// applies reloaded configurations, only restarting the modules that changed.
+type moduleRunner struct {
+	ctx context.Context
+	sb  *StatusBar
+
+	wg      sync.WaitGroup
+	modules map[string]*runningModule
+
+	sigChan chan os.Signal
+
+	// refresh maps refresh signals to the names of the modules they refresh.
+	refreshLock sync.Mutex
+	refresh     map[os.Signal][]string
+
+	load configLoader
+
+	// pending is the latest valid configuration, waiting to be applied.
+	pendingLock sync.Mutex
+	pending     *Config
+	reloads     chan struct{}
+}
+
+// runningModule is a module started by the runner.
+type runningModule struct {
+	// config identifies the configuration the module was started with.
+	config string
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newModuleRunner returns a runner running modules until the context is
+// canceled.  If load is nil, the configuration can't be reloaded.
+func newModuleRunner(ctx context.Context, sb *StatusBar, sigChan chan os.Signal, refresh map[os.Signal][]string, load configLoader) *moduleRunner {
+	r := &moduleRunner{
+		ctx:     ctx,
+		sb:      sb,
+		modules: make(map[string]*runningModule),
+		sigChan: sigChan,
+		refresh: refresh,
+		load:    load,
+		reloads: make(chan struct{}, 1),
+	}
+
+	if load != nil {
+		sb.OnReload(r.reload)
+	}
+
+	return r
+}
+
+// reload loads and validates the configuration, which is applied later by
+// applyReloads, so that a module can ask for a reload that stops itself.
+func (r *moduleRunner) reload() error {
+	cfg, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	r.pendingLock.Lock()
+	r.pending = cfg
+	r.pendingLock.Unlock()
+
+	notify(r.reloads)
+
+	return nil
+}
+
+// apply starts the modules of a configuration, stopping the modules that were
+// removed or whose configuration changed, and leaving the others running.
+// The status functions are the configuration's built modules.
+func (r *moduleRunner) apply(cfg *Config, statusFuncs []statusFunc) {
+	configs := make(map[string]string, len(cfg.Modules))
+	for i := range cfg.Modules {
+		mc := &cfg.Modules[i]
+		configs[mc.name()] = moduleConfigKey(cfg, mc)
+	}
+
+	// Every stopped module is canceled before waiting for any, so that they
+	// shut down together.
+	var stopped []string
+	for name, rm := range r.modules {
+		if configs[name] != rm.config {
+			rm.cancel()
+			stopped = append(stopped, name)
+		}
+	}
+
+	for _, name := range stopped {
+		<-r.modules[name].done
+		delete(r.modules, name)
+
+		r.sb.RemoveModule(name)
+		logging.New(name).Info("module stopped")
+	}
+
+	for i, statusFunc := range statusFuncs {
+		mc := &cfg.Modules[i]
+		name := mc.name()
+
+		r.sb.SetPosition(name, mc.position(i))
+
+		if _, ok := r.modules[name]; ok {
+			continue
+		}
+
+		r.sb.SetBindings(name, mc.Clicks)
+		r.start(name, configs[name], statusFunc)
+	}
+}
+
+// start runs a module under supervision.
+func (r *moduleRunner) start(name, config string, fn statusFunc) {
+	ctx, cancel := context.WithCancel(r.ctx)
+
+	rm := &runningModule{
+		config: config,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	r.modules[name] = rm
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		defer close(rm.done)
+		defer cancel()
+
+		supervise(ctx, r.sb, name, fn)
+	}()
+}
+
+// handle starts handling signals and reloads, until the context is canceled.
+func (r *moduleRunner) handle() {
+	go r.handleSignals()
+
+	// Reloads start modules, so they are done before wait returns.
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.applyReloads()
+	}()
+}
+
+// wait waits for every module to stop, after the bar's context is canceled.
+func (r *moduleRunner) wait() {
+	r.wg.Wait()
+}
+
+// handleSignals pauses and resumes the status bar when swaybar sends the stop
+// and continue signals advertised in the header, refreshes modules when
+// their refresh signal is received, and reloads the configuration.  Reloads
+// are applied by applyReloads, so that the signals are still handled while
+// modules are being restarted.
+func (r *moduleRunner) handleSignals() {
+	for {
+		select {
+		case sig := <-r.sigChan:
+			switch sig {
+			case stopSignal:
+				r.sb.Stop()
+			case contSignal:
+				r.sb.Continue()
+			case reloadSignal:
+				if err := r.sb.Reload(); err != nil {
+					logging.Error("failed to reload configuration, keeping the current one", "err", err)
+				}
+			default:
+				r.refreshLock.Lock()
+				names := r.refresh[sig]
+				r.refreshLock.Unlock()
+
+				for _, name := range names {
+					r.sb.Refresh(name)
+				}
+			}
+
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// applyReloads applies reloaded configurations, one at a time.
+func (r *moduleRunner) applyReloads() {
+	for {
+		select {
+		case <-r.reloads:
+			r.pendingLock.Lock()
+			cfg := r.pending
+			r.pending = nil
+			r.pendingLock.Unlock()
+
+			if cfg != nil {
+				r.reconfigure(cfg)
+			}
+
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// reconfigure applies a reloaded configuration.
+func (r *moduleRunner) reconfigure(cfg *Config) {
+	theme, err := loadTheme(cfg.Theme)
+	if err != nil {
+		logging.Error("failed to reload theme, keeping the current configuration", "err", err)
+		return
+	}
+
+	statusFuncs, err := cfg.build()
+	if err != nil {
+		logging.Error("failed to reload modules, keeping the current configuration", "err", err)
+		return
+	}
+
+	// Blocks of the modules that keep running are sent again with the new
+	// theme.
+	r.sb.SetTheme(theme)
+	r.apply(cfg, statusFuncs)
+
+	// Signals that are no longer used stay registered, and are ignored,
+	// rather than killing the process with their default action.
+	refresh := refreshSignals(cfg)
+
+	r.refreshLock.Lock()
+	for sig := range refresh {
+		if _, ok := r.refresh[sig]; !ok {
+			signal.Notify(r.sigChan, sig)
+		}
+	}
+	r.refresh = refresh
+	r.refreshLock.Unlock()
+
+	names := make([]string, 0, len(cfg.Modules))
+	for i := range cfg.Modules {
+		names = append(names, cfg.Modules[i].name())
+	}
+
+	logging.Info("configuration reloaded", "modules", strings.Join(names, ","))
+}
+
+// moduleConfigKey identifies a module's configuration, including the global
+// settings that affect it, so that changes can be detected.  The position is
+// left out, as it is changed without restarting the module.
+func moduleConfigKey(cfg *Config, mc *ModuleConfig) string {
+	c := *mc
+	c.Position = nil
+
+	b, err := json.Marshal(struct {
+		Module        ModuleConfig      `json:"module"`
+		Icons         string            `json:"icons"`
+		IconOverrides map[string]string `json:"icon_overrides"`
+	}{c, cfg.Icons, cfg.IconOverrides})
+	if err != nil {
+		// The configuration was decoded from JSON, so this can't happen.
+		panic(err)
+	}
+
+	return string(b)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tom5760/swaybar-status/pango"
+)
+
+// textSeparator separates blocks in outputs without their own separators.
+const textSeparator = " | "
+
+// Renderer writes the status bar in some output format.
+type Renderer interface {
+	// Start writes anything that comes before the first update.
+	Start() error
+
+	// Render writes the blocks currently on the bar.
+	Render(blocks []Block) error
+
+	// End finishes the output.
+	End() error
+
+	// ClickEvents reports whether the consumer of the output sends click
+	// events back on standard input.
+	ClickEvents() bool
+}
+
+// clickReader is implemented by renderers that make click events themselves,
+// rather than the consumer of the output sending them on standard input.
+type clickReader interface {
+	// ReadClicks reads input until the context is canceled, passing click
+	// events to click.  Returning ends the status bar.
+	ReadClicks(ctx context.Context, in io.Reader, click func(ClickEvent)) error
+}
+
+// renderers maps output format names to renderer constructors.
+var renderers = map[string]func(w io.Writer) Renderer{
+	// The i3bar protocol is the one swaybar implements.
+	"swaybar":  newSwaybarRenderer,
+	"i3bar":    newSwaybarRenderer,
+	"waybar":   newWaybarRenderer,
+	"lemonbar": newLemonbarRenderer,
+	"text":     newTextRenderer,
+	"preview": func(w io.Writer) Renderer {
+		return newPreviewRenderer(w)
+	},
+}
+
+// newRenderer creates a renderer for the named output format.
+func newRenderer(name string, w io.Writer) (Renderer, error) {
+	fn, ok := renderers[name]
+	if !ok {
+		names := make([]string, 0, len(renderers))
+		for n := range renderers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		return nil, fmt.Errorf("unknown output %q; expected one of %s", name, strings.Join(names, ", "))
+	}
+
+	return fn(w), nil
+}
+
+// plainText returns a block's full text without any markup.
+func plainText(block Block) string {
+	if block.Markup == markupPango {
+		return pango.Plain(pango.Markup(block.FullText))
+	}
+	return block.FullText
+}
+
+// swaybarRenderer writes the swaybar (and i3bar) JSON protocol; a header,
+// followed by an infinite array of arrays of blocks.
+type swaybarRenderer struct {
+	w       io.Writer
+	encoder *json.Encoder
+}
+
+func newSwaybarRenderer(w io.Writer) Renderer {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	return &swaybarRenderer{
+		w:       w,
+		encoder: encoder,
+	}
+}
+
+func (r *swaybarRenderer) Start() error {
+	if err := r.encoder.Encode(header); err != nil {
+		return fmt.Errorf("failed to encode header: %w", err)
+	}
+
+	if _, err := r.w.Write([]byte("[{}\n")); err != nil {
+		return fmt.Errorf("failed to write body start: %w", err)
+	}
+
+	return nil
+}
+
+func (r *swaybarRenderer) Render(blocks []Block) error {
+	if _, err := r.w.Write([]byte{','}); err != nil {
+		return fmt.Errorf("failed to write body array separator: %w", err)
+	}
+
+	if err := r.encoder.Encode(blocks); err != nil {
+		return fmt.Errorf("failed to encode blocks: %w", err)
+	}
+
+	return nil
+}
+
+func (r *swaybarRenderer) End() error {
+	if _, err := r.w.Write([]byte{']', '\n'}); err != nil {
+		return fmt.Errorf("failed to write body array end: %w", err)
+	}
+
+	return nil
+}
+
+func (r *swaybarRenderer) ClickEvents() bool {
+	return true
+}
+
+// waybarRenderer writes a JSON object per update for a waybar custom module
+// with "return-type": "json".  Usually it is combined with -only to show a
+// single module per waybar module.
+type waybarRenderer struct {
+	encoder *json.Encoder
+}
+
+type waybarOutput struct {
+	Text       string   `json:"text"`
+	Alt        string   `json:"alt,omitempty"`
+	Tooltip    string   `json:"tooltip,omitempty"`
+	Class      []string `json:"class,omitempty"`
+	Percentage int      `json:"percentage,omitempty"`
+}
+
+func newWaybarRenderer(w io.Writer) Renderer {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	return &waybarRenderer{encoder: encoder}
+}
+
+func (r *waybarRenderer) Start() error {
+	return nil
+}
+
+func (r *waybarRenderer) Render(blocks []Block) error {
+	var (
+		out      waybarOutput
+		texts    []string
+		tooltips []string
+		classes  = make(map[string]bool)
+	)
+
+	for _, block := range blocks {
+		// Waybar always parses the text as markup.
+		text := block.FullText
+		if block.Markup != markupPango {
+			text = pango.Escape(text)
+		}
+
+		texts = append(texts, text)
+		tooltips = append(tooltips, pango.Escape(plainText(block)))
+
+		if out.Alt == "" {
+			out.Alt = block.Name
+		}
+
+		if out.Percentage == 0 {
+			out.Percentage = block.Percentage
+		}
+
+		classes[block.State.String()] = true
+		if block.Urgent {
+			classes["urgent"] = true
+		}
+	}
+
+	out.Text = strings.Join(texts, textSeparator)
+	out.Tooltip = strings.Join(tooltips, "\n")
+
+	for class := range classes {
+		out.Class = append(out.Class, class)
+	}
+	sort.Strings(out.Class)
+
+	if err := r.encoder.Encode(out); err != nil {
+		return fmt.Errorf("failed to encode waybar output: %w", err)
+	}
+
+	return nil
+}
+
+func (r *waybarRenderer) End() error {
+	return nil
+}
+
+func (r *waybarRenderer) ClickEvents() bool {
+	return false
+}
+
+// lemonbarRenderer writes a line of lemonbar formatted text per update, with
+// the blocks aligned to the right.
+type lemonbarRenderer struct {
+	w io.Writer
+}
+
+var lemonbarEscaper = strings.NewReplacer("%", "%%")
+
+func newLemonbarRenderer(w io.Writer) Renderer {
+	return &lemonbarRenderer{w: w}
+}
+
+func (r *lemonbarRenderer) Start() error {
+	return nil
+}
+
+func (r *lemonbarRenderer) Render(blocks []Block) error {
+	var b strings.Builder
+
+	b.WriteString("%{r}")
+
+	for i, block := range blocks {
+		if i > 0 {
+			b.WriteString(textSeparator)
+		}
+
+		if block.Urgent {
+			b.WriteString("%{R}")
+		}
+		if block.Color != "" {
+			fmt.Fprintf(&b, "%%{F%s}", block.Color)
+		}
+		if block.Background != "" {
+			fmt.Fprintf(&b, "%%{B%s}", block.Background)
+		}
+
+		b.WriteString(lemonbarEscaper.Replace(plainText(block)))
+
+		if block.Background != "" {
+			b.WriteString("%{B-}")
+		}
+		if block.Color != "" {
+			b.WriteString("%{F-}")
+		}
+		if block.Urgent {
+			b.WriteString("%{R}")
+		}
+	}
+
+	b.WriteByte('\n')
+
+	if _, err := io.WriteString(r.w, b.String()); err != nil {
+		return fmt.Errorf("failed to write lemonbar line: %w", err)
+	}
+
+	return nil
+}
+
+func (r *lemonbarRenderer) End() error {
+	return nil
+}
+
+func (r *lemonbarRenderer) ClickEvents() bool {
+	return false
+}
+
+// textRenderer writes a line of plain text per update, e.g. for the tmux
+// status line.
+type textRenderer struct {
+	w io.Writer
+}
+
+func newTextRenderer(w io.Writer) Renderer {
+	return &textRenderer{w: w}
+}
+
+func (r *textRenderer) Start() error {
+	return nil
+}
+
+func (r *textRenderer) Render(blocks []Block) error {
+	texts := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		texts = append(texts, strings.ReplaceAll(plainText(block), "\n", " "))
+	}
+
+	if _, err := fmt.Fprintln(r.w, strings.Join(texts, textSeparator)); err != nil {
+		return fmt.Errorf("failed to write text line: %w", err)
+	}
+
+	return nil
+}
+
+func (r *textRenderer) End() error {
+	return nil
+}
+
+func (r *textRenderer) ClickEvents() bool {
+	return false
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/tom5760/swaybar-status/logging"
+)
+
+// sessionSettleTime is how long a status line must stay on the bar for it to
+// be compared when replaying a session.  Clicks in a recording should be
+// further apart.
+const sessionSettleTime = Duration(100 * time.Millisecond)
+
+// Session is a recording of the protocol between swaybar and the status bar:
+// the header and updates written by the status bar, and the click events sent
+// to it, with their offsets from the start of the session.  Replaying a
+// session with deterministic modules gives the same updates, so recordings
+// can be used as golden files.
+type Session struct {
+	// Config is the configuration the session was recorded with.
+	Config *Config `json:"config,omitempty"`
+
+	// Duration is how long the session lasted.
+	Duration Duration `json:"duration"`
+
+	Header  Header          `json:"header"`
+	Clicks  []SessionClick  `json:"clicks,omitempty"`
+	Updates []SessionUpdate `json:"updates"`
+}
+
+// SessionClick is a click event sent to the status bar.
+type SessionClick struct {
+	At    Duration   `json:"at"`
+	Event ClickEvent `json:"event"`
+}
+
+// SessionUpdate is a status line written by the status bar.
+type SessionUpdate struct {
+	At     Duration `json:"at"`
+	Blocks []Block  `json:"blocks"`
+}
+
+// sessionRecorder collects a session from the input and output streams.
+type sessionRecorder struct {
+	lock    sync.Mutex
+	start   time.Time
+	session Session
+}
+
+func newSessionRecorder() *sessionRecorder {
+	return &sessionRecorder{start: time.Now()}
+}
+
+func (r *sessionRecorder) since() Duration {
+	return Duration(time.Since(r.start))
+}
+
+// readOutput parses the output of the status bar, recording the header and
+// every update.
+func (r *sessionRecorder) readOutput(out io.Reader) error {
+	decoder := json.NewDecoder(out)
+
+	var header Header
+	if err := decoder.Decode(&header); err != nil {
+		return fmt.Errorf("failed to decode header: %w", err)
+	}
+
+	r.lock.Lock()
+	r.session.Header = header
+	r.lock.Unlock()
+
+	if err := expectDelim(decoder, '['); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return fmt.Errorf("failed to decode status line: %w", err)
+		}
+
+		// The body starts with an empty object, so that every status line
+		// can be preceded by a comma.
+		if bytes.HasPrefix(raw, []byte{'{'}) {
+			continue
+		}
+
+		var blocks []Block
+		if err := json.Unmarshal(raw, &blocks); err != nil {
+			return fmt.Errorf("failed to decode status line: %w", err)
+		}
+
+		r.lock.Lock()
+		r.session.Updates = append(r.session.Updates, SessionUpdate{
+			At:     r.since(),
+			Blocks: blocks,
+		})
+		r.lock.Unlock()
+	}
+
+	return expectDelim(decoder, ']')
+}
+
+// readInput parses the click events sent to the status bar.
+func (r *sessionRecorder) readInput(in io.Reader) error {
+	eofIn := &eofReader{r: in}
+	decoder := json.NewDecoder(eofIn)
+
+	if err := expectDelim(decoder, '['); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		var evt ClickEvent
+		if err := decoder.Decode(&evt); err != nil {
+			// swaybar never ends the array, the input just stops.
+			if eofIn.eof {
+				return nil
+			}
+			return fmt.Errorf("failed to decode click event: %w", err)
+		}
+
+		r.lock.Lock()
+		r.session.Clicks = append(r.session.Clicks, SessionClick{
+			At:    r.since(),
+			Event: evt,
+		})
+		r.lock.Unlock()
+	}
+
+	return nil
+}
+
+// finish returns the recorded session.
+func (r *sessionRecorder) finish(cfg *Config) *Session {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	session := r.session
+	session.Config = cfg
+	session.Duration = r.since()
+
+	return &session
+}
+
+// eofReader remembers whether the underlying reader has reached EOF.
+type eofReader struct {
+	r   io.Reader
+	eof bool
+}
+
+func (r *eofReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	tok, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("failed to read %v: %w", delim, err)
+	}
+
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("unexpected token %v; expected %v", tok, delim)
+	}
+
+	return nil
+}
+
+// recordSession runs the status bar, recording the session to a file when it
+// ends.
+func recordSession(path string, cfg *Config, in io.Reader, out io.Writer) error {
+	rec := newSessionRecorder()
+
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		if err := rec.readInput(inReader); err != nil && !errors.Is(err, io.EOF) {
+			logging.Warn("failed to record input", "err", err)
+		}
+		io.Copy(ioutil.Discard, inReader)
+	}()
+
+	go func() {
+		defer wg.Done()
+		if err := rec.readOutput(outReader); err != nil && !errors.Is(err, io.EOF) {
+			logging.Warn("failed to record output", "err", err)
+		}
+		io.Copy(ioutil.Discard, outReader)
+	}()
+
+	runErr := run(cfg, "swaybar", io.TeeReader(in, inWriter), io.MultiWriter(out, outWriter), nil)
+
+	inWriter.Close()
+	outWriter.Close()
+	wg.Wait()
+
+	if err := writeSession(path, rec.finish(cfg)); err != nil {
+		return err
+	}
+
+	return runErr
+}
+
+// playSession runs the status bar as swaybar would, sending it the session's
+// click events at their offsets, and records the result.
+func playSession(session *Session) (*Session, error) {
+	rec := newSessionRecorder()
+
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+
+	readDone := make(chan error, 1)
+	go func() {
+		err := rec.readOutput(outReader)
+		io.Copy(ioutil.Discard, outReader)
+		readDone <- err
+	}()
+
+	go func() {
+		defer inWriter.Close()
+
+		encoder := json.NewEncoder(inWriter)
+
+		if _, err := inWriter.Write([]byte("[\n")); err != nil {
+			return
+		}
+
+		for i, click := range session.Clicks {
+			time.Sleep(time.Until(rec.start.Add(time.Duration(click.At))))
+
+			if i > 0 {
+				if _, err := inWriter.Write([]byte{','}); err != nil {
+					return
+				}
+			}
+
+			if err := encoder.Encode(click.Event); err != nil {
+				return
+			}
+		}
+
+		// Closing the input ends the session, as when swaybar exits.
+		time.Sleep(time.Until(rec.start.Add(time.Duration(session.Duration))))
+	}()
+
+	runErr := run(session.Config, "swaybar", inReader, outWriter, nil)
+	outWriter.Close()
+
+	if err := <-readDone; err != nil {
+		return nil, fmt.Errorf("failed to read output: %w", err)
+	}
+
+	if runErr != nil && !errors.Is(runErr, errInputClosed) {
+		return nil, runErr
+	}
+
+	return rec.finish(session.Config), nil
+}
+
+// replaySession plays a recorded session, and reports any difference in the
+// output.  If update is set, the recording is replaced instead.  If cfg is not
+// nil, it replaces the configuration in the recording.
+func replaySession(path string, cfg *Config, update bool) error {
+	golden, err := readSession(path)
+	if err != nil {
+		return err
+	}
+
+	if cfg != nil {
+		golden.Config = cfg
+	}
+
+	if golden.Config == nil {
+		return fmt.Errorf("session %s has no configuration", path)
+	}
+
+	session, err := playSession(golden)
+	if err != nil {
+		return fmt.Errorf("failed to replay session: %w", err)
+	}
+
+	if update {
+		session.Clicks = golden.Clicks
+		return writeSession(path, session)
+	}
+
+	return golden.compare(session)
+}
+
+// compare reports the first difference between the status lines of two
+// sessions.  Timing is ignored, as are repeated status lines, as the writer
+// may coalesce updates differently.  Status lines replaced before they settle
+// are ignored too, as modules updating together may do so in any order.
+func (s *Session) compare(other *Session) error {
+	if s.Header != other.Header {
+		return fmt.Errorf("header differs: got %+v; expected %+v", other.Header, s.Header)
+	}
+
+	want := s.settledUpdates()
+	got := other.settledUpdates()
+
+	for i := 0; i < len(want) && i < len(got); i++ {
+		if !reflect.DeepEqual(want[i], got[i]) {
+			return fmt.Errorf("status line %d differs:\n  got:      %s\n  expected: %s",
+				i, marshalBlocks(got[i]), marshalBlocks(want[i]))
+		}
+	}
+
+	if len(got) != len(want) {
+		return fmt.Errorf("got %d distinct status lines; expected %d", len(got), len(want))
+	}
+
+	return nil
+}
+
+// settledUpdates returns the distinct status lines that stayed on the bar
+// for at least sessionSettleTime, and the last one.  Lines only missing
+// blocks of the next line are skipped, as how long it takes every module to
+// report depends on how fast they start.
+func (s *Session) settledUpdates() [][]Block {
+	var settled Session
+
+	for i, update := range s.Updates {
+		if i+1 < len(s.Updates) {
+			next := s.Updates[i+1]
+			if next.At-update.At < sessionSettleTime || addsBlocks(update.Blocks, next.Blocks) {
+				continue
+			}
+		}
+		settled.Updates = append(settled.Updates, update)
+	}
+
+	return settled.distinctUpdates()
+}
+
+// addsBlocks reports whether next has the same blocks as prev, and more.
+func addsBlocks(prev, next []Block) bool {
+	if len(next) <= len(prev) {
+		return false
+	}
+
+	blocks := make(map[BlockKey]Block, len(next))
+	for _, block := range next {
+		blocks[block.Key()] = block
+	}
+
+	for _, block := range prev {
+		if b, ok := blocks[block.Key()]; !ok || !reflect.DeepEqual(b, block) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *Session) distinctUpdates() [][]Block {
+	var updates [][]Block
+
+	for _, update := range s.Updates {
+		if n := len(updates); n > 0 && reflect.DeepEqual(updates[n-1], update.Blocks) {
+			continue
+		}
+		updates = append(updates, update.Blocks)
+	}
+
+	return updates
+}
+
+func marshalBlocks(blocks []Block) string {
+	b, err := json.Marshal(blocks)
+	if err != nil {
+		return fmt.Sprintf("%+v", blocks)
+	}
+	return string(b)
+}
+
+func readSession(path string) (*Session, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+
+	var session Session
+	if err := decodeStrict(b, &session); err != nil {
+		return nil, fmt.Errorf("invalid session %s: %w", path, err)
+	}
+
+	if session.Config != nil {
+		if _, err := session.Config.build(); err != nil {
+			return nil, fmt.Errorf("invalid session %s: %w", path, err)
+		}
+	}
+
+	return &session, nil
+}
+
+func writeSession(path string, session *Session) error {
+	b, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+
+	if err := ioutil.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestSessions replays the recorded sessions in testdata, which only use
+// deterministic modules.  Run with -args -update to record them again.
+func TestSessions(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.session.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(paths) == 0 {
+		t.Fatal("no sessions in testdata")
+	}
+
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			t.Parallel()
+
+			if err := replaySession(path, nil, *updateFlag); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSessionRecorderReadOutput(t *testing.T) {
+	out := `{"version":1,"click_events":true}
+[
+{},
+[{"full_text":"a","name":"x"}],
+[{"full_text":"b","name":"x","instance":"1"},{"full_text":"c","name":"y"}]
+]
+`
+
+	rec := newSessionRecorder()
+	if err := rec.readOutput(strings.NewReader(out)); err != nil {
+		t.Fatalf("readOutput: %v", err)
+	}
+
+	session := rec.finish(nil)
+
+	if want := (Header{Version: 1, ClickEvents: true}); session.Header != want {
+		t.Errorf("header = %+v; want %+v", session.Header, want)
+	}
+
+	want := [][]Block{
+		{{FullText: "a", Name: "x"}},
+		{{FullText: "b", Name: "x", Instance: "1"}, {FullText: "c", Name: "y"}},
+	}
+
+	if got := session.distinctUpdates(); !reflect.DeepEqual(got, want) {
+		t.Errorf("updates = %+v; want %+v", got, want)
+	}
+}
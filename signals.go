@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const (
+	// sigRTMin is SIGRTMIN as seen by other processes.  The kernel's first
+	// real-time signal is 32, but glibc reserves two for itself, so tools
+	// like pkill count from 34.
+	sigRTMin = 34
+
+	// maxRefreshSignal is the largest N allowed for SIGRTMIN+N, leaving
+	// SIGRTMAX (64) alone.
+	maxRefreshSignal = 29
+)
+
+// refreshSignal returns the signal SIGRTMIN+n.
+func refreshSignal(n int) os.Signal {
+	return syscall.Signal(sigRTMin + n)
+}
+
+// refreshSignals maps the refresh signals in the configuration to the names
+// of the modules they refresh.
+func refreshSignals(cfg *Config) map[os.Signal][]string {
+	refresh := make(map[os.Signal][]string)
+
+	for i := range cfg.Modules {
+		mc := &cfg.Modules[i]
+		if mc.Signal != 0 {
+			sig := refreshSignal(mc.Signal)
+			refresh[sig] = append(refresh[sig], mc.name())
+		}
+	}
+
+	return refresh
+}
+
+// notifySignals starts listening for the signals the status bar handles, the
+// given refresh signals, and, if reload is set, the reload signal.  It must be
+// called before the header is written, as swaybar may send a stop signal
+// right away, which would otherwise terminate the process.
+func notifySignals(refresh map[os.Signal][]string, reload bool) (chan os.Signal, func()) {
+	sigs := []os.Signal{stopSignal, contSignal}
+	if reload {
+		sigs = append(sigs, reloadSignal)
+	}
+	for sig := range refresh {
+		sigs = append(sigs, sig)
+	}
+
+	// Signals are dropped when the channel is full, so there is room for a
+	// burst, e.g. swaybar hiding and showing the bar in quick succession.
+	sigChan := make(chan os.Signal, 16)
+	signal.Notify(sigChan, sigs...)
+
+	return sigChan, func() { signal.Stop(sigChan) }
+}
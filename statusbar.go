@@ -1,76 +1,176 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
 	"sort"
 	"sync"
+	"syscall"
 	"time"
-
-	"golang.org/x/sync/singleflight"
 )
 
 const (
+	// writeDebounceTime is the minimum time between writes to the bar.
+	// Updates are coalesced so that the first update after an idle period is
+	// written immediately, and later ones wait at most this long.
 	writeDebounceTime = 250 * time.Millisecond
 )
 
+const (
+	// stopSignal and contSignal are sent by swaybar when the bar is hidden
+	// and shown again.
+	stopSignal = syscall.SIGUSR1
+	contSignal = syscall.SIGUSR2
+)
+
 var header = Header{
 	Version:     1,
 	ClickEvents: true,
+	StopSignal:  int(stopSignal),
+	ContSignal:  int(contSignal),
 }
 
 type StatusBar struct {
-	sf   singleflight.Group
 	lock sync.Mutex
 
-	w       io.Writer
-	encoder *json.Encoder
+	renderer Renderer
 
 	blockMap  map[BlockKey]Block
 	blockList []Block
 
-	clickMap map[BlockKey]func(ClickEvent)
+	// positions orders blocks by name; seqs keeps blocks with the same name
+	// in the order they were first added.
+	positions map[string]int
+	seqs      map[BlockKey]uint64
+	nextSeq   uint64
+
+	clickMap   map[BlockKey]ClickFunc
+	clickLocks map[BlockKey]chan struct{}
+	bindings   map[string][]ClickBinding
+
+	// clickTimeout is clickTimeout, unless shortened by tests.
+	clickTimeout time.Duration
+
+	theme *Theme
+
+	// errs are the errors displayed for each module, by name.  Entries are
+	// kept after the error is cleared to remember whether it was expanded.
+	errs map[string]*moduleError
+
+	// visible is closed while the bar is being displayed, and replaced when
+	// it is hidden.
+	visible chan struct{}
+	hidden  bool
+
+	// refreshes wake modules to update their blocks immediately.
+	refreshes map[string]chan struct{}
+
+	// reload reloads the configuration, if supported.
+	reload func() error
+
+	// dirty signals the writer that blocks have changed.
+	dirty      chan struct{}
+	done       chan struct{}
+	writerDone chan struct{}
+
+	// failed is closed when writing to the bar fails, with the error in err.
+	failed chan struct{}
+	err    error
 }
 
-func NewStatusBar(w io.Writer) *StatusBar {
-	encoder := json.NewEncoder(w)
-	encoder.SetEscapeHTML(false)
+func NewStatusBar(r Renderer) *StatusBar {
+	visible := make(chan struct{})
+	close(visible)
 
 	return &StatusBar{
-		w:        w,
-		encoder:  encoder,
-		blockMap: make(map[BlockKey]Block),
-		clickMap: make(map[BlockKey]func(ClickEvent)),
+		renderer:     r,
+		blockMap:     make(map[BlockKey]Block),
+		positions:    make(map[string]int),
+		seqs:         make(map[BlockKey]uint64),
+		clickMap:     make(map[BlockKey]ClickFunc),
+		clickLocks:   make(map[BlockKey]chan struct{}),
+		clickTimeout: clickTimeout,
+		bindings:     make(map[string][]ClickBinding),
+		errs:         make(map[string]*moduleError),
+
+		visible:   visible,
+		refreshes: make(map[string]chan struct{}),
+
+		dirty:      make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		writerDone: make(chan struct{}),
+		failed:     make(chan struct{}),
 	}
 }
 
 func (s *StatusBar) Open() error {
-	if err := s.encoder.Encode(header); err != nil {
-		return fmt.Errorf("failed to encode header: %w", err)
+	if err := s.renderer.Start(); err != nil {
+		return err
 	}
 
-	if _, err := s.w.Write([]byte("[{}\n")); err != nil {
-		return fmt.Errorf("failed to write body start: %w", err)
-	}
+	go s.writeLoop()
 
 	return nil
 }
 
+// Close flushes any pending update, and ends the output.
 func (s *StatusBar) Close() error {
-	if _, err := s.w.Write([]byte{']', '\n'}); err != nil {
-		return fmt.Errorf("failed to write body array end: %w", err)
-	}
+	close(s.done)
+	<-s.writerDone
 
-	if cl, ok := s.w.(io.Closer); ok {
-		return cl.Close()
+	// Nothing more can be written once the bar is broken, and the error has
+	// already been reported through Failed.
+	if s.Err() != nil {
+		return nil
 	}
 
-	return nil
+	return s.renderer.End()
+}
+
+// SetTheme sets the theme used to style blocks by their state.
+func (s *StatusBar) SetTheme(theme *Theme) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.theme = theme
+	s.markDirty()
+}
+
+// SetPosition sets the position of blocks with the given name.  Blocks are
+// displayed in increasing order of position; blocks whose name has no
+// position are displayed last, sorted by name.
+func (s *StatusBar) SetPosition(name string, position int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.positions[name] = position
+	s.sort()
+	s.markDirty()
+}
+
+// Position returns the position of blocks with the given name, if it has been
+// set.
+func (s *StatusBar) Position(name string) (int, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	position, ok := s.positions[name]
+	return position, ok
+}
+
+// ClearPosition forgets the position of blocks with the given name, which are
+// then displayed last.
+func (s *StatusBar) ClearPosition(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.positions, name)
+	s.sort()
+	s.markDirty()
 }
 
-// Update inserts or updates a block to the status bar.  Blocks are sorted
-// lexographically by Name-Instance.
+// Update inserts or updates a block to the status bar.  Blocks are sorted by
+// the position of their Name, then by the order in which each Instance was
+// first added.
 func (s *StatusBar) Update(block Block) {
 	if block.Name == "" {
 		panic("block has no name")
@@ -88,9 +188,14 @@ func (s *StatusBar) Update(block Block) {
 		return
 	}
 
+	if _, ok := s.blockMap[key]; !ok {
+		s.seqs[key] = s.nextSeq
+		s.nextSeq++
+	}
+
 	s.blockMap[key] = block
 	s.sort()
-	s.write()
+	s.markDirty()
 }
 
 // Removes a block based on its Name-Instance key.
@@ -99,38 +204,240 @@ func (s *StatusBar) Remove(key BlockKey) {
 	defer s.lock.Unlock()
 
 	delete(s.blockMap, key)
+	delete(s.seqs, key)
 	s.sort()
-	s.write()
+	s.markDirty()
+}
+
+// Failed returns a channel that is closed when writing to the bar fails, e.g.
+// because swaybar has exited.  No further updates are written after that.
+func (s *StatusBar) Failed() <-chan struct{} {
+	return s.failed
 }
 
-func (s *StatusBar) OnClick(key BlockKey, fn func(ClickEvent)) {
+// Err returns the error that caused writing to fail, if any.
+func (s *StatusBar) Err() error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	s.clickMap[key] = fn
+	return s.err
 }
 
-func (s *StatusBar) Click(evt ClickEvent) {
-	key := BlockKey{
-		Name:     evt.Name,
-		Instance: evt.Instance,
+// RemoveAll removes every block with the given name.
+func (s *StatusBar) RemoveAll(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for key := range s.blockMap {
+		if key.Name == name {
+			delete(s.blockMap, key)
+			delete(s.seqs, key)
+		}
 	}
 
-	if fn, ok := s.clickMap[key]; ok {
-		fn(evt)
+	s.sort()
+	s.markDirty()
+}
+
+// RemoveModule forgets everything about the module with the given name: its
+// blocks, click handlers and bindings, error and position.  The module must
+// have stopped.
+func (s *StatusBar) RemoveModule(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for key := range s.blockMap {
+		if key.Name == name {
+			delete(s.blockMap, key)
+			delete(s.seqs, key)
+		}
 	}
+
+	for key := range s.clickMap {
+		if key.Name == name {
+			delete(s.clickMap, key)
+		}
+	}
+
+	delete(s.bindings, name)
+	delete(s.errs, name)
+	delete(s.positions, name)
+
+	s.sort()
+	s.markDirty()
 }
 
-func (s *StatusBar) write() error {
-	if _, err := s.w.Write([]byte{','}); err != nil {
-		return fmt.Errorf("failed to write body array separator: %w", err)
+// Stop pauses writing to the bar and module updates, e.g. because swaybar
+// has hidden the bar.
+func (s *StatusBar) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.hidden {
+		return
 	}
 
-	if err := s.encoder.Encode(s.blockList); err != nil {
-		return fmt.Errorf("failed to encode blocks: %w", err)
+	s.hidden = true
+	s.visible = make(chan struct{})
+}
+
+// Continue resumes after Stop, rewriting the bar and asking every module for
+// a refresh.
+func (s *StatusBar) Continue() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.hidden {
+		return
 	}
 
-	return nil
+	s.hidden = false
+	close(s.visible)
+	s.markDirty()
+
+	for _, ch := range s.refreshes {
+		notify(ch)
+	}
+}
+
+// Visible reports whether the bar is currently displayed.
+func (s *StatusBar) Visible() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return !s.hidden
+}
+
+// WaitVisible blocks while the bar is hidden.  Modules that poll should call
+// it before doing any work.
+func (s *StatusBar) WaitVisible(ctx context.Context) error {
+	s.lock.Lock()
+	visible := s.visible
+	s.lock.Unlock()
+
+	select {
+	case <-visible:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Refreshes returns a channel that receives when the module with the given
+// name should update its blocks right away.
+func (s *StatusBar) Refreshes(name string) <-chan struct{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.refreshChan(name)
+}
+
+// Refresh asks the module with the given name to update its blocks.
+func (s *StatusBar) Refresh(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	notify(s.refreshChan(name))
+}
+
+func (s *StatusBar) refreshChan(name string) chan struct{} {
+	ch, ok := s.refreshes[name]
+	if !ok {
+		ch = make(chan struct{}, 1)
+		s.refreshes[name] = ch
+	}
+
+	return ch
+}
+
+// markDirty wakes the writer.  Must be called with the lock held.
+func (s *StatusBar) markDirty() {
+	notify(s.dirty)
+}
+
+// notify does a non-blocking send on a channel with a buffer of one.
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (s *StatusBar) writeLoop() {
+	defer close(s.writerDone)
+
+	var last time.Time
+
+	for {
+		closing := false
+
+		select {
+		case <-s.dirty:
+		case <-s.done:
+			// Flush an update that raced with closing.
+			select {
+			case <-s.dirty:
+				closing = true
+			default:
+				return
+			}
+		}
+
+		if !closing {
+			if wait := writeDebounceTime - time.Since(last); wait > 0 {
+				timer := time.NewTimer(wait)
+
+				select {
+				case <-timer.C:
+				case <-s.done:
+					timer.Stop()
+					closing = true
+				}
+			}
+		}
+
+		// Hold updates while the bar is hidden; Continue marks the bar dirty
+		// again once it is shown.
+		s.lock.Lock()
+		visible := s.visible
+		s.lock.Unlock()
+
+		if !closing {
+			select {
+			case <-visible:
+			case <-s.done:
+				return
+			}
+		}
+
+		// Everything up to now is included in this write.
+		select {
+		case <-s.dirty:
+		default:
+		}
+
+		s.lock.Lock()
+		blocks := make([]Block, len(s.blockList))
+		for i, block := range s.blockList {
+			blocks[i] = s.theme.apply(withShortText(block))
+		}
+		s.lock.Unlock()
+
+		if err := s.renderer.Render(blocks); err != nil {
+			s.lock.Lock()
+			s.err = err
+			s.lock.Unlock()
+
+			close(s.failed)
+			return
+		}
+
+		last = time.Now()
+
+		if closing {
+			return
+		}
+	}
 }
 
 func (s *StatusBar) sort() {
@@ -144,12 +451,20 @@ func (s *StatusBar) sort() {
 		a := s.blockList[i]
 		b := s.blockList[j]
 
-		if a.Name > b.Name {
-			return true
-		}
-		if a.Name < b.Name {
-			return false
+		if a.Name != b.Name {
+			pa, aok := s.positions[a.Name]
+			pb, bok := s.positions[b.Name]
+
+			switch {
+			case aok && bok && pa != pb:
+				return pa < pb
+			case aok != bok:
+				return aok
+			default:
+				return a.Name < b.Name
+			}
 		}
-		return a.Instance > b.Instance
+
+		return s.seqs[a.Key()] < s.seqs[b.Key()]
 	})
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tom5760/swaybar-status/logging"
+)
+
+const (
+	restartMinBackoff = 1 * time.Second
+	restartMaxBackoff = 5 * time.Minute
+
+	// restartResetTime is how long a module must run before a failure is
+	// considered unrelated to the previous one, resetting the backoff.
+	restartResetTime = 1 * time.Minute
+)
+
+// supervise runs a module until the context is canceled, restarting it with
+// exponential backoff when it fails.  While the module is waiting to be
+// restarted, its blocks are replaced by an error block.
+func supervise(ctx context.Context, sb *StatusBar, name string, fn statusFunc) {
+	log := logging.New(name)
+	backoff := restartMinBackoff
+
+	for {
+		start := time.Now()
+		err := runModule(ctx, sb, fn)
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err == nil {
+			log.Info("module finished")
+			return
+		}
+
+		if time.Since(start) > restartResetTime {
+			backoff = restartMinBackoff
+		}
+
+		log.Error("module failed", "restart_in", backoff, "err", err)
+
+		sb.RemoveAll(name)
+		sb.ShowError(name, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+
+		sb.ClearError(name)
+
+		backoff *= 2
+		if backoff > restartMaxBackoff {
+			backoff = restartMaxBackoff
+		}
+	}
+}
+
+// runModule runs a module's status function, turning a panic into an error so
+// that one module can't take down the whole bar.
+func runModule(ctx context.Context, sb *StatusBar, fn statusFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return fn(ctx, sb)
+}
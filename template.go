@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/tom5760/swaybar-status/pango"
+)
+
+// barRunes are the partial blocks used to draw bars, in eighths.
+var barRunes = []rune(" ▏▎▍▌▋▊▉█")
+
+// templateFuncs are the helper functions available in module templates.
+// Arguments are ordered so that the value can be piped in, e.g.
+// {{.Title | truncate 20}}.
+var templateFuncs = template.FuncMap{
+	"pad":      padRight,
+	"lpad":     padLeft,
+	"truncate": truncate,
+	"bar":      bar,
+	"duration": humanDuration,
+	"escape":   pango.Escape,
+}
+
+// parseTemplate parses a module template.  It is executed with the module's
+// zero data, so that references to unknown fields are reported when the
+// configuration is loaded, rather than when the module runs.  An empty text
+// results in a nil template.
+func parseTemplate(name, text string, data interface{}) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	// Errors from the template package already name the template.
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.Execute(ioutil.Discard, data); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// padRight pads a string with spaces on the right to the given display width.
+func padRight(width int, s string) string {
+	if n := width - textWidth(s); n > 0 {
+		return s + strings.Repeat(" ", n)
+	}
+	return s
+}
+
+// padLeft pads a string with spaces on the left to the given display width.
+func padLeft(width int, s string) string {
+	if n := width - textWidth(s); n > 0 {
+		return strings.Repeat(" ", n) + s
+	}
+	return s
+}
+
+// truncate ellipsizes a string to the given display width.
+func truncate(width int, s string) string {
+	return ellipsize(s, width)
+}
+
+// bar draws a horizontal bar graph of a percentage, the given number of cells
+// wide.  The percentage may be any kind of number.
+func bar(width int, percent interface{}) (string, error) {
+	v := reflect.ValueOf(percent)
+
+	var p float64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		p = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		p = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		p = v.Float()
+	default:
+		return "", fmt.Errorf("bar: percentage must be a number; got %T", percent)
+	}
+
+	p = math.Max(0, math.Min(100, p))
+
+	eighths := int(math.Round(p / 100 * float64(width*8)))
+	full := barRunes[len(barRunes)-1]
+
+	var b strings.Builder
+	for i := 0; i < width; i++ {
+		switch {
+		case eighths >= 8:
+			b.WriteRune(full)
+			eighths -= 8
+		default:
+			b.WriteRune(barRunes[eighths])
+			eighths = 0
+		}
+	}
+
+	return b.String(), nil
+}
+
+// humanDuration formats a duration compactly, with at most two units, e.g.
+// "1d2h", "3h05m", "12m" or "40s".
+func humanDuration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+
+	switch {
+	case d >= 24*time.Hour:
+		d = d.Round(time.Hour)
+		return fmt.Sprintf("%dd%dh", d/(24*time.Hour), d%(24*time.Hour)/time.Hour)
+
+	case d >= time.Hour:
+		d = d.Round(time.Minute)
+		return fmt.Sprintf("%dh%02dm", d/time.Hour, d%time.Hour/time.Minute)
+
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm", d.Round(time.Minute)/time.Minute)
+
+	default:
+		return fmt.Sprintf("%ds", d.Round(time.Second)/time.Second)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// makeRaw is only implemented on Linux.  Elsewhere the preview is shown
+// without keyboard input.
+func makeRaw(fd uintptr) (func() error, error) {
+	return nil, errors.New("raw terminal mode isn't supported on this platform")
+}
+
+// termWidth is only implemented on Linux.  Elsewhere the preview's lines are
+// not cut to the terminal's width.
+func termWidth(fd uintptr) (int, error) {
+	return 0, errors.New("terminal size isn't supported on this platform")
+}
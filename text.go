@@ -0,0 +1,151 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/tom5760/swaybar-status/pango"
+)
+
+const (
+	ellipsis = "…"
+
+	// shortTextWidth is the width that derived short text is limited to.
+	shortTextWidth = 16
+)
+
+// wideRanges are ranges of runes that are displayed two cells wide: East
+// Asian wide and fullwidth characters, and emoji.
+var wideRanges = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x1100, Hi: 0x115F, Stride: 1},
+		{Lo: 0x231A, Hi: 0x231B, Stride: 1},
+		{Lo: 0x23E9, Hi: 0x23EC, Stride: 1},
+		{Lo: 0x23F0, Hi: 0x23F0, Stride: 1},
+		{Lo: 0x23F3, Hi: 0x23F3, Stride: 1},
+		{Lo: 0x25FD, Hi: 0x25FE, Stride: 1},
+		{Lo: 0x2614, Hi: 0x2615, Stride: 1},
+		{Lo: 0x26A1, Hi: 0x26A1, Stride: 1},
+		{Lo: 0x26AA, Hi: 0x26AB, Stride: 1},
+		{Lo: 0x26BD, Hi: 0x26BE, Stride: 1},
+		{Lo: 0x26C4, Hi: 0x26C5, Stride: 1},
+		{Lo: 0x26D4, Hi: 0x26D4, Stride: 1},
+		{Lo: 0x26EA, Hi: 0x26EA, Stride: 1},
+		{Lo: 0x26F2, Hi: 0x26F5, Stride: 1},
+		{Lo: 0x26FA, Hi: 0x26FD, Stride: 1},
+		{Lo: 0x2705, Hi: 0x2705, Stride: 1},
+		{Lo: 0x270A, Hi: 0x270B, Stride: 1},
+		{Lo: 0x2728, Hi: 0x2728, Stride: 1},
+		{Lo: 0x274C, Hi: 0x274C, Stride: 1},
+		{Lo: 0x2753, Hi: 0x2755, Stride: 1},
+		{Lo: 0x2757, Hi: 0x2757, Stride: 1},
+		{Lo: 0x2795, Hi: 0x2797, Stride: 1},
+		{Lo: 0x27B0, Hi: 0x27B0, Stride: 1},
+		{Lo: 0x27BF, Hi: 0x27BF, Stride: 1},
+		{Lo: 0x2E80, Hi: 0x303E, Stride: 1},
+		{Lo: 0x3041, Hi: 0x33FF, Stride: 1},
+		{Lo: 0x3400, Hi: 0x4DBF, Stride: 1},
+		{Lo: 0x4E00, Hi: 0x9FFF, Stride: 1},
+		{Lo: 0xA000, Hi: 0xA4CF, Stride: 1},
+		{Lo: 0xAC00, Hi: 0xD7A3, Stride: 1},
+		{Lo: 0xF900, Hi: 0xFAFF, Stride: 1},
+		{Lo: 0xFE30, Hi: 0xFE4F, Stride: 1},
+		{Lo: 0xFF00, Hi: 0xFF60, Stride: 1},
+		{Lo: 0xFFE0, Hi: 0xFFE6, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1F300, Hi: 0x1F64F, Stride: 1},
+		{Lo: 0x1F680, Hi: 0x1F6FF, Stride: 1},
+		{Lo: 0x1F900, Hi: 0x1F9FF, Stride: 1},
+		{Lo: 0x1FA70, Hi: 0x1FAFF, Stride: 1},
+		{Lo: 0x20000, Hi: 0x3FFFD, Stride: 1},
+	},
+}
+
+// runeWidth returns the number of terminal-like cells a rune occupies.
+func runeWidth(r rune) int {
+	switch {
+	case r == 0x200D, unicode.Is(unicode.Variation_Selector, r):
+		return 0
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf, unicode.Cc):
+		return 0
+	case unicode.Is(wideRanges, r):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// textWidth returns the display width of a string.
+func textWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// ellipsize shortens a string to at most the given display width, ending it
+// with an ellipsis if anything was cut.
+func ellipsize(s string, width int) string {
+	if textWidth(s) <= width {
+		return s
+	}
+
+	limit := width - textWidth(ellipsis)
+	if limit < 0 {
+		return ""
+	}
+
+	var b strings.Builder
+
+	used := 0
+	for _, r := range s {
+		w := runeWidth(r)
+		if used+w > limit {
+			break
+		}
+		used += w
+		b.WriteRune(r)
+	}
+
+	return strings.TrimRightFunc(b.String(), unicode.IsSpace) + ellipsis
+}
+
+// deriveShortText makes a compact version of a block's full text, for blocks
+// that don't provide one: details in parentheses or after a dash are dropped,
+// usually leaving an icon and a value, and the rest is ellipsized.
+func deriveShortText(full string) string {
+	short := full
+
+	for _, sep := range []string{" (", " - "} {
+		if i := strings.Index(short, sep); i > 0 {
+			short = short[:i]
+		}
+	}
+
+	return ellipsize(strings.TrimSpace(short), shortTextWidth)
+}
+
+// withShortText fills in derived short text for a block without any.  For
+// blocks using markup, it is derived from the plain text, and escaped, as the
+// markup can't be cut safely.
+func withShortText(block Block) Block {
+	if block.ShortText != "" {
+		return block
+	}
+
+	if block.Markup != markupPango {
+		if short := deriveShortText(block.FullText); short != block.FullText {
+			block.ShortText = short
+		}
+		return block
+	}
+
+	plain := pango.Plain(pango.Markup(block.FullText))
+	if short := deriveShortText(plain); short != plain {
+		block.ShortText = pango.Escape(short)
+	}
+
+	return block
+}
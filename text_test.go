@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestWithShortText(t *testing.T) {
+	tests := []struct {
+		name  string
+		block Block
+		want  string
+	}{
+		{
+			name:  "kept",
+			block: Block{FullText: "full", ShortText: "short"},
+			want:  "short",
+		},
+		{
+			name:  "fits",
+			block: Block{FullText: "⚡ 80%"},
+			want:  "",
+		},
+		{
+			name:  "details dropped",
+			block: Block{FullText: "⚡ 80% (2:15 remaining)"},
+			want:  "⚡ 80%",
+		},
+		{
+			name:  "pango fits",
+			block: Block{FullText: "<b>⚡ 80%</b>", Markup: markupPango},
+			want:  "",
+		},
+		{
+			name:  "pango details dropped",
+			block: Block{FullText: `<span foreground="red">⚡ 80%</span> <small>(2:15 remaining)</small>`, Markup: markupPango},
+			want:  "⚡ 80%",
+		},
+		{
+			name:  "pango escaped",
+			block: Block{FullText: "<b>Rock &amp; Roll - Some Band</b>", Markup: markupPango},
+			want:  "Rock &amp; Roll",
+		},
+		{
+			name:  "pango ellipsized",
+			block: Block{FullText: "<i>A &lt;very&gt; long title without details</i>", Markup: markupPango},
+			want:  "A &lt;very&gt; long t…",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := withShortText(test.block).ShortText; got != test.want {
+				t.Errorf("ShortText = %q; want %q", got, test.want)
+			}
+		})
+	}
+}
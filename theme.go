@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// State is the semantic state of a block, e.g. a low battery is a warning.
+type State int
+
+const (
+	StateIdle State = iota
+	StateInfo
+	StateGood
+	StateWarning
+	StateCritical
+)
+
+// Style is how a theme displays blocks in a state.  Empty fields leave the
+// block unchanged.
+type Style struct {
+	Color               string `json:"color,omitempty"`
+	Background          string `json:"background,omitempty"`
+	Border              string `json:"border,omitempty"`
+	BorderTop           int    `json:"border_top,omitempty"`
+	BorderBottom        int    `json:"border_bottom,omitempty"`
+	BorderLeft          int    `json:"border_left,omitempty"`
+	BorderRight         int    `json:"border_right,omitempty"`
+	Separator           *bool  `json:"separator,omitempty"`
+	SeparatorBlockWidth int    `json:"separator_block_width,omitempty"`
+}
+
+// Theme maps block states to styles.
+type Theme struct {
+	Idle     Style `json:"idle"`
+	Info     Style `json:"info"`
+	Good     Style `json:"good"`
+	Warning  Style `json:"warning"`
+	Critical Style `json:"critical"`
+}
+
+// themes are the built-in themes, by name.
+var themes = map[string]Theme{
+	"default": {
+		Warning:  Style{Color: "#FFB86C"},
+		Critical: Style{Color: errorColor},
+	},
+
+	"solarized": {
+		Idle:     Style{Color: "#93A1A1"},
+		Info:     Style{Color: "#268BD2"},
+		Good:     Style{Color: "#859900"},
+		Warning:  Style{Color: "#B58900"},
+		Critical: Style{Color: "#FDF6E3", Background: "#DC322F"},
+	},
+
+	"gruvbox": {
+		Idle:     Style{Color: "#EBDBB2"},
+		Info:     Style{Color: "#83A598"},
+		Good:     Style{Color: "#B8BB26"},
+		Warning:  Style{Color: "#FABD2F"},
+		Critical: Style{Color: "#FBF1C7", Background: "#CC241D"},
+	},
+}
+
+// loadTheme returns the built-in theme with the given name, or reads a theme
+// from a JSON file if the name is a path.
+func loadTheme(name string) (*Theme, error) {
+	if name == "" {
+		name = "default"
+	}
+
+	if !strings.ContainsRune(name, '/') {
+		theme, ok := themes[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown theme %q", name)
+		}
+		return &theme, nil
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read theme: %w", err)
+	}
+
+	var theme Theme
+	if err := decodeStrict(b, &theme); err != nil {
+		return nil, fmt.Errorf("invalid theme %s: %w", name, err)
+	}
+
+	return &theme, nil
+}
+
+func (t *Theme) style(state State) Style {
+	switch state {
+	case StateInfo:
+		return t.Info
+	case StateGood:
+		return t.Good
+	case StateWarning:
+		return t.Warning
+	case StateCritical:
+		return t.Critical
+	default:
+		return t.Idle
+	}
+}
+
+// apply fills in the style for the block's state.  Anything the block sets
+// itself is left alone.
+func (t *Theme) apply(block Block) Block {
+	style := t.style(block.State)
+
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+
+	fillInt := func(dst *int, src int) {
+		if *dst == 0 {
+			*dst = src
+		}
+	}
+
+	fill(&block.Color, style.Color)
+	fill(&block.Background, style.Background)
+	fill(&block.Border, style.Border)
+	fillInt(&block.BorderTop, style.BorderTop)
+	fillInt(&block.BorderBottom, style.BorderBottom)
+	fillInt(&block.BorderLeft, style.BorderLeft)
+	fillInt(&block.BorderRight, style.BorderRight)
+	fillInt(&block.SeparatorBlockWidth, style.SeparatorBlockWidth)
+
+	if block.Separator == nil {
+		block.Separator = style.Separator
+	}
+
+	return block
+}
+
+// parseState parses the name of a state, as returned by String.
+func parseState(name string) (State, error) {
+	for s := StateIdle; s <= StateCritical; s++ {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+
+	return StateIdle, fmt.Errorf("unknown state %q", name)
+}
+
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateInfo:
+		return "info"
+	case StateGood:
+		return "good"
+	case StateWarning:
+		return "warning"
+	case StateCritical:
+		return "critical"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
@@ -2,28 +2,114 @@ package main
 
 import (
 	"context"
+	"errors"
 	"time"
+
+	"github.com/tom5760/swaybar-status/pango"
+)
+
+const (
+	timeFormat      = "Mon Jan 2, 2006 3:04PM"
+	timeShortFormat = "3:04PM"
 )
 
-const timeFormat = "Mon Jan 2, 2006 3:04PM"
+var (
+	timeActions = []string{"toggle-format"}
+
+	timeBindings = []ClickBinding{
+		{Button: 1, Action: "toggle-format"},
+	}
+)
+
+// timeData is the data time templates are executed with.
+type timeData struct {
+	Time time.Time
+
+	// Text is the time formatted with Format, or AltFormat after a click.
+	Text string
+}
+
+type timeOptions struct {
+	// Format is a Go time layout, see the time package.
+	Format string `json:"format"`
+
+	// AltFormat is shown instead of Format after a click, if set.
+	AltFormat string `json:"alt_format"`
+
+	// ShortFormat is shown when the bar runs out of space.
+	ShortFormat string `json:"short_format"`
+
+	// Interval is how often to update the clock.
+	Interval Duration `json:"interval"`
+}
+
+func newTimeModule(mc *ModuleConfig) (statusFunc, error) {
+	opts := timeOptions{
+		Format:      timeFormat,
+		ShortFormat: timeShortFormat,
+		Interval:    Duration(1 * time.Second),
+	}
+
+	if err := mc.decodeOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	if opts.Interval <= 0 {
+		return nil, errors.New("interval must be positive")
+	}
 
-func statusTime(ctx context.Context, sb *StatusBar) error {
+	m := mc.module()
+
+	return func(ctx context.Context, sb *StatusBar) error {
+		return statusTime(ctx, sb, m, opts)
+	}, nil
+}
+
+func statusTime(ctx context.Context, sb *StatusBar, m module, opts timeOptions) error {
 	block := Block{
-		Name: "00-time",
+		Name: m.name,
 	}
 
 	timer := time.NewTimer(0)
+	refresh := sb.Refreshes(m.name)
+
+	toggle := make(chan struct{}, 1)
+	alt := false
+
+	sb.BindActions(block.Key(), map[string]ClickFunc{
+		"toggle-format": func(ctx context.Context, evt ClickEvent) {
+			notify(toggle)
+		},
+	}, timeBindings)
 
 	for ctx.Err() == nil {
 		select {
 		case <-timer.C:
-			block.FullText = time.Now().Format(timeFormat)
-			sb.Update(block)
-			timer.Reset(1 * time.Second)
-
+		case <-refresh:
+		case <-toggle:
+			alt = !alt && opts.AltFormat != ""
 		case <-ctx.Done():
 			return nil
 		}
+
+		if err := sb.WaitVisible(ctx); err != nil {
+			return nil
+		}
+
+		format := opts.Format
+		if alt {
+			format = opts.AltFormat
+		}
+
+		now := time.Now()
+		data := timeData{
+			Time: now,
+			Text: now.Format(format),
+		}
+
+		m.format(&block, data, pango.Text(data.Text), pango.Text(now.Format(opts.ShortFormat)))
+		sb.Update(block)
+		resetTimer(timer, time.Duration(opts.Interval))
 	}
 
 	return nil
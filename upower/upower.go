@@ -4,13 +4,15 @@ package upower
 
 import (
 	"fmt"
-	"log"
 
 	"github.com/godbus/dbus/v5"
 
+	"github.com/tom5760/swaybar-status/logging"
 	"github.com/tom5760/swaybar-status/utils"
 )
 
+var log = logging.New("upower")
+
 const (
 	upowerIface = "org.freedesktop.UPower"
 
@@ -198,13 +200,13 @@ func deviceSigChanLoop(sigChan <-chan *dbus.Signal, devChan chan<- *Device) {
 	for sig := range sigChan {
 		var objPath dbus.ObjectPath
 		if err := dbus.Store(sig.Body, &objPath); err != nil {
-			log.Println("failed to store signal:", err)
+			log.Warn("failed to store signal", "signal", sig.Name, "err", err)
 			continue
 		}
 
 		dev, err := newDevice(objPath)
 		if err != nil {
-			log.Println("failed to create new device:", err)
+			log.Warn("failed to create new device", "path", objPath, "err", err)
 			continue
 		}
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"strconv"
+	"time"
 )
 
 func readFileString(name string) (string, error) {
@@ -28,3 +29,16 @@ func readFileInt64(name string) (int64, error) {
 
 	return intv, nil
 }
+
+// resetTimer stops and resets a timer, draining its channel if it already
+// fired without being received from.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+
+	t.Reset(d)
+}
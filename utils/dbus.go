@@ -2,12 +2,16 @@ package utils
 
 import (
 	"fmt"
-	"log"
 	"strings"
 
 	"github.com/godbus/dbus/v5"
+
+	"github.com/tom5760/swaybar-status/logging"
 )
 
+// log tags D-Bus records, which are mostly debug signal traffic.
+var log = logging.New("dbus")
+
 const (
 	dbusInterface = "org.freedesktop.DBus"
 
@@ -250,6 +254,8 @@ func DBusSignalSubscribe(conn *dbus.Conn, name string, opts ...dbus.MatchOption)
 		return nil, nil, fmt.Errorf("failed to add match signal: %w", err)
 	}
 
+	log.Debug("subscribed to signal", "signal", name)
+
 	sigChan := make(chan *dbus.Signal, 1)
 	conn.Signal(sigChan)
 
@@ -268,6 +274,8 @@ func DBusSignalSubscribe(conn *dbus.Conn, name string, opts ...dbus.MatchOption)
 					continue
 				}
 
+				log.Debug("received signal", "signal", sig.Name, "sender", sig.Sender, "path", sig.Path, "body", sig.Body)
+
 				filterSigChan <- sig
 
 			case <-cancelChan:
@@ -280,9 +288,11 @@ func DBusSignalSubscribe(conn *dbus.Conn, name string, opts ...dbus.MatchOption)
 		conn.RemoveSignal(sigChan)
 
 		if err := conn.RemoveMatchSignal(matchOptions...); err != nil {
-			log.Println("failed to remove match signal: %w", err)
+			log.Warn("failed to remove match signal", "signal", name, "err", err)
 		}
 
+		log.Debug("unsubscribed from signal", "signal", name)
+
 		close(sigChan)
 		close(cancelChan)
 		close(filterSigChan)
@@ -311,7 +321,7 @@ func DBusSubscribePropertyChanges(conn *dbus.Conn, opts ...dbus.MatchOption) (<-
 				&change.ChangedProperties,
 				&change.InvalidatedProperties,
 			); err != nil {
-				log.Println("failed to store signal:", err)
+				log.Warn("failed to store signal", "signal", sig.Name, "err", err)
 				continue
 			}
 
@@ -353,7 +363,7 @@ func DBusSubscribeNameOwnerChanged(conn *dbus.Conn, opts ...dbus.MatchOption) (<
 				&change.OldOwner,
 				&change.NewOwner,
 			); err != nil {
-				log.Println("failed to store signal:", err)
+				log.Warn("failed to store signal", "signal", sig.Name, "err", err)
 				continue
 			}
 
@@ -2,23 +2,68 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"os/exec"
 
 	"github.com/lawl/pulseaudio"
+
+	"github.com/tom5760/swaybar-status/pango"
 )
 
-const (
-	speakerMuted = "🔇"
-	speakerLow   = "🔈"
-	speakerMed   = "🔉"
-	speakerHigh  = "🔊"
+const volumeScrollDelta = .02
+
+var (
+	volumeActions = []string{"mute", "next-sink", "mixer", "volume-up", "volume-down"}
 
-	volumeScrollDelta = .02
+	volumeBindings = []ClickBinding{
+		{Button: 1, Action: "mute"},
+		{Button: 1, Modifiers: []string{ModShift}, Action: "next-sink"},
+		{Button: 3, Action: "mixer"},
+		{Button: 4, Action: "volume-up"},
+		{Button: 5, Action: "volume-down"},
+	}
 )
 
-func statusVolume(ctx context.Context, sb *StatusBar) error {
+// volumeData is the data volume templates are executed with.
+type volumeData struct {
+	// Volume is a percentage.
+	Volume int
+	Muted  bool
+	Icon   string
+}
+
+type volumeOptions struct {
+	// ScrollStep is the volume change for each scroll wheel click, as a
+	// fraction of full volume.
+	ScrollStep float32 `json:"scroll_step"`
+
+	// Mixer is the program launched with a right click.
+	Mixer string `json:"mixer"`
+}
+
+func newVolumeModule(mc *ModuleConfig) (statusFunc, error) {
+	opts := volumeOptions{
+		ScrollStep: volumeScrollDelta,
+		Mixer:      "pavucontrol",
+	}
+
+	if err := mc.decodeOptions(&opts); err != nil {
+		return nil, err
+	}
+
+	if opts.ScrollStep <= 0 || opts.ScrollStep > 1 {
+		return nil, errors.New("scroll_step must be between 0 and 1")
+	}
+
+	m := mc.module()
+
+	return func(ctx context.Context, sb *StatusBar) error {
+		return statusVolume(ctx, sb, m, opts)
+	}, nil
+}
+
+func statusVolume(ctx context.Context, sb *StatusBar, m module, opts volumeOptions) error {
 	client, err := pulseaudio.NewClient()
 	if err != nil {
 		return fmt.Errorf("failed to create pulseaudio client: %w", err)
@@ -32,30 +77,50 @@ func statusVolume(ctx context.Context, sb *StatusBar) error {
 	}
 
 	block := Block{
-		Name: "10-volume",
+		Name: m.name,
 	}
 
-	sb.OnClick(block.Key(), func(evt ClickEvent) {
-		switch evt.Button {
-		case 1:
+	actions := map[string]ClickFunc{
+		"mute": func(ctx context.Context, evt ClickEvent) {
 			if _, err := client.ToggleMute(); err != nil {
-				log.Println("failed to toggle mute:", err)
+				m.log.Warn("failed to toggle mute", "err", err)
 			}
+		},
 
-		case 3:
-			if err := exec.Command("swaymsg", "exec", "pavucontrol").Start(); err != nil {
-				log.Println("failed to start pavucontrol:", err)
+		"next-sink": func(ctx context.Context, evt ClickEvent) {
+			if err := nextSink(ctx, client); err != nil {
+				m.log.Warn("failed to switch sink", "err", err)
 			}
+		},
 
-		case 4:
-			setVolume(client, volumeScrollDelta)
+		"mixer": func(ctx context.Context, evt ClickEvent) {
+			if opts.Mixer == "" {
+				return
+			}
 
-		case 5:
-			setVolume(client, -volumeScrollDelta)
-		}
-	})
+			if err := exec.Command("swaymsg", "exec", opts.Mixer).Start(); err != nil {
+				m.log.Warn("failed to start mixer", "mixer", opts.Mixer, "err", err)
+			}
+		},
+
+		"volume-up": func(ctx context.Context, evt ClickEvent) {
+			if err := setVolume(client, opts.ScrollStep); err != nil {
+				m.log.Warn("failed to raise volume", "err", err)
+			}
+		},
+
+		"volume-down": func(ctx context.Context, evt ClickEvent) {
+			if err := setVolume(client, -opts.ScrollStep); err != nil {
+				m.log.Warn("failed to lower volume", "err", err)
+			}
+		},
+	}
+
+	sb.BindActions(block.Key(), actions, volumeBindings)
+
+	updateVolumeBlock(sb, m, client)
 
-	updateVolumeBlock(sb, client)
+	refresh := sb.Refreshes(m.name)
 
 	for {
 		select {
@@ -63,54 +128,63 @@ func statusVolume(ctx context.Context, sb *StatusBar) error {
 			return nil
 
 		case <-updates:
-			updateVolumeBlock(sb, client)
+			if sb.Visible() {
+				updateVolumeBlock(sb, m, client)
+			}
+
+		case <-refresh:
+			updateVolumeBlock(sb, m, client)
 		}
 	}
 }
 
-func updateVolumeBlock(sb *StatusBar, client *pulseaudio.Client) {
+func updateVolumeBlock(sb *StatusBar, m module, client *pulseaudio.Client) {
 	block := Block{
-		Name:     "10-volume",
-		FullText: "Error",
+		Name: m.name,
 	}
 
 	volume, err := client.Volume()
 	if err != nil {
-		log.Printf("failed to get volume: %v", err)
-		sb.Update(block)
+		sb.Remove(block.Key())
+		sb.ShowError(m.name, fmt.Errorf("failed to get volume: %w", err))
 		return
 	}
 
 	muted, err := client.Mute()
 	if err != nil {
-		log.Printf("failed to get mute state: %v", err)
-		sb.Update(block)
+		sb.Remove(block.Key())
+		sb.ShowError(m.name, fmt.Errorf("failed to get mute state: %w", err))
 		return
 	}
 
-	icon := speakerMuted
+	sb.ClearError(m.name)
 
+	icon := m.icons.get(iconVolumeMuted)
 	if !muted {
-		switch {
-		case volume == 0:
-			icon = speakerLow
-		case volume <= .5:
-			icon = speakerMed
-		default:
-			icon = speakerHigh
-		}
+		icon = m.icons.level(float64(volume*100), volumeIconLevels)
 	}
 
-	block.FullText = fmt.Sprintf("%s%.0f%%", icon, volume*100)
+	data := volumeData{
+		Volume: int(volume*100 + .5),
+		Muted:  muted,
+		Icon:   icon,
+	}
+
+	m.format(&block, data, pango.Text(fmt.Sprintf("%s%.0f%%", icon, volume*100)), "")
+
+	block.Percentage = data.Volume
+
+	if muted {
+		block.State = StateInfo
+	}
 
 	sb.Update(block)
 }
 
-func setVolume(client *pulseaudio.Client, diff float32) {
+func setVolume(client *pulseaudio.Client, diff float32) error {
 	volume, err := client.Volume()
 	if err != nil {
-		log.Printf("failed to get volume: %v", err)
-		return
+		return fmt.Errorf("failed to get volume: %w", err)
 	}
 
 	next := volume + diff
@@ -124,7 +198,42 @@ func setVolume(client *pulseaudio.Client, diff float32) {
 	}
 
 	if err := client.SetVolume(next); err != nil {
-		log.Printf("failed to set volume: %v", err)
-		return
+		return fmt.Errorf("failed to set volume: %w", err)
+	}
+
+	return nil
+}
+
+// nextSink makes the sink after the current default the new default, so that
+// clicking repeatedly cycles through all sinks.
+func nextSink(ctx context.Context, client *pulseaudio.Client) error {
+	sinks, err := client.Sinks()
+	if err != nil {
+		return fmt.Errorf("failed to list sinks: %w", err)
+	}
+
+	if len(sinks) == 0 {
+		return errors.New("no sinks")
+	}
+
+	server, err := client.ServerInfo()
+	if err != nil {
+		return fmt.Errorf("failed to get server info: %w", err)
 	}
+
+	next := sinks[0]
+	for i, sink := range sinks {
+		if sink.Name == server.DefaultSink {
+			next = sinks[(i+1)%len(sinks)]
+			break
+		}
+	}
+
+	// The pulseaudio client doesn't expose setting the default sink.
+	cmd := exec.CommandContext(ctx, "pactl", "set-default-sink", next.Name)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set default sink %s: %w: %s", next.Name, err, out)
+	}
+
+	return nil
 }